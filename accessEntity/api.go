@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/apid/apidApiMetadata/common"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -57,6 +58,9 @@ const (
 	AppTypeCompany   = "COMPANY"
 )
 
+// parent type of app credentials in ambiguity errors
+const ParentTypeApp = "APP"
+
 const (
 	StatusApproved = "APPROVED"
 	StatusRevoked  = "REVOKED"
@@ -65,6 +69,22 @@ const (
 
 const headerRequestId = "X-Gateway-Request-Id"
 
+// query parameter, if true the resource matching the apiresource identifier is returned
+const ParameterMatchedResource = "matchedresource"
+
+// query parameter, if true all the entities matching the identifiers are returned instead of an ambiguity error
+const ParameterMultiple = "multiple"
+
+// query parameters selecting the attributes of responses and their format, see common.AttributeOptions
+const (
+	// comma separated attribute names, may be repeated
+	ParameterAttributes = "attributes"
+	// common.AttributesFormatList or common.AttributesFormatMap
+	ParameterAttributesFormat = "attributesformat"
+	// if true, JSON-valued attributes are decoded
+	ParameterTypedAttributes = "typedattributes"
+)
+
 var (
 	Identifiers = map[string]bool{
 		"appid":          true,
@@ -119,6 +139,18 @@ var (
 			IdentifierConsumerKey:    {},
 		},
 	}
+
+	/*
+	 * ManyResultsIdentifiers holds, by endpoint, the primary identifiers whose lookups match several entities by design,
+	 * such as the apiproducts of an app. They are not ambiguous: the first match is returned, or all of them with multiple=true.
+	 */
+	ManyResultsIdentifiers = map[string]map[string]bool{
+		EndpointApiProduct: {
+			IdentifierAppId:       true,
+			IdentifierAppName:     true,
+			IdentifierConsumerKey: true,
+		},
+	}
 )
 
 const (
@@ -131,12 +163,20 @@ const (
 	NOT_FOUND
 	// json Marshal Error
 	JSON_MARSHAL_ERROR
+	// 409, the identifiers match several entities
+	AMBIGUOUS_IDENTIFIERS
 )
 
 type ApiManager struct {
 	DbMan            DbManagerInterface
 	AccessEntityPath string
-	apiInitialized   bool
+	// optional, nil returns secrets in plaintext
+	Redaction *RedactionPolicy
+	// if true, the apiProductReferences of credentials are returned as api product names, without their status
+	LegacyProductReferences bool
+	// encrypts secrets for RedactEncrypt
+	CipherManager  common.CipherManagerInterface
+	apiInitialized bool
 }
 
 func (a *ApiManager) InitAPI() {
@@ -162,31 +202,88 @@ func (a *ApiManager) handleEndpoint(endpoint string, w http.ResponseWriter, r *h
 				ResponseMessage: err.Error(),
 				StatusCode:      http.StatusBadRequest,
 			}, w, r)
+		return
 	}
+	attrOpts, err := extractAttributeOptions(r.URL.Query())
+	if err != nil {
+		writeJson(http.StatusBadRequest,
+			common.ErrorResponse{
+				ResponseCode:    strconv.Itoa(INVALID_PARAMETERS),
+				ResponseMessage: err.Error(),
+				StatusCode:      http.StatusBadRequest,
+			}, w, r)
+		return
+	}
+	expand, err := parseExpansion(endpoint, r.URL.Query())
+	if err != nil {
+		writeJson(http.StatusBadRequest,
+			common.ErrorResponse{
+				ResponseCode:    strconv.Itoa(INVALID_PARAMETERS),
+				ResponseMessage: err.Error(),
+				StatusCode:      http.StatusBadRequest,
+			}, w, r)
+		return
+	}
+	// all queries of the request read the same DB version
+	pin := a.DbMan.PinDb()
+	defer pin.Release()
+	w.Header().Set(common.HeaderDbVersion, pin.Version)
+	pinned := *a
+	pinned.DbMan = a.DbMan.WithPin(pin)
+	a = &pinned
+
+	multiple := r.URL.Query().Get(ParameterMultiple) == "true"
 	var res interface{}
 	var errRes *common.ErrorResponse
-	switch endpoint {
-	case EndpointApp:
-		res, errRes = a.getApp(org, ids)
-	case EndpointApiProduct:
-		res, errRes = a.getApiProduct(org, ids)
-	case EndpointCompany:
-		res, errRes = a.getCompany(org, ids)
-	case EndpointCompanyDeveloper:
-		res, errRes = a.getCompanyDeveloper(org, ids)
-	case EndpointDeveloper:
-		res, errRes = a.getDeveloper(org, ids)
-	case EndpointAppCredentials:
-		res, errRes = a.getAppCredential(org, ids)
+	if filterKey, filterVal, ok := parseListFilter(endpoint, ids); ok {
+		res, errRes = a.listEntities(endpoint, org, filterKey, filterVal, r.URL.Query(), expand)
+	} else {
+		switch endpoint {
+		case EndpointApp:
+			res, errRes = a.getApp(org, ids, multiple, expand)
+		case EndpointApiProduct:
+			res, errRes = a.getApiProduct(org, ids, r.URL.Query().Get(ParameterMatchedResource) == "true", multiple)
+		case EndpointCompany:
+			res, errRes = a.getCompany(org, ids)
+		case EndpointCompanyDeveloper:
+			res, errRes = a.getCompanyDeveloper(org, ids)
+		case EndpointDeveloper:
+			res, errRes = a.getDeveloper(org, ids)
+		case EndpointAppCredentials:
+			res, errRes = a.getAppCredential(org, ids, multiple, expand)
+		}
 	}
 
 	if errRes != nil {
 		writeJson(errRes.StatusCode, errRes, w, r)
 		return
 	}
+	if res, err = attrOpts.ShapeResponse(res); err != nil {
+		log.Errorf("Failed to shape the attributes of %s: %v", endpoint, err)
+		writeJson(http.StatusInternalServerError,
+			common.ErrorResponse{
+				ResponseCode:    strconv.Itoa(JSON_MARSHAL_ERROR),
+				ResponseMessage: err.Error(),
+				StatusCode:      http.StatusInternalServerError,
+			}, w, r)
+		return
+	}
 	writeJson(http.StatusOK, res, w, r)
 }
 
+// extractAttributeOptions parses the query parameters selecting the attributes of the response
+func extractAttributeOptions(pars url.Values) (*common.AttributeOptions, error) {
+	opts := &common.AttributeOptions{
+		Names:  common.ParseAttributeNames(pars[ParameterAttributes]),
+		Format: strings.ToLower(pars.Get(ParameterAttributesFormat)),
+		Typed:  pars.Get(ParameterTypedAttributes) == "true",
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
 func (a *ApiManager) HandleApps(w http.ResponseWriter, r *http.Request) {
 	a.handleEndpoint(EndpointApp, w, r)
 }
@@ -247,20 +344,38 @@ func (a *ApiManager) getCompanyDeveloper(org string, ids map[string]string) (*Co
 		return nil, ErrNotFound
 	}
 
-	var details []*CompanyDeveloperDetails
+	comIds := make([]string, 0, len(devs))
+	devIds := make([]string, 0, len(devs))
 	for _, dev := range devs {
-		comName, err := a.DbMan.GetComNames(dev.CompanyId, TypeCompany)
-		if err != nil || len(comName) == 0 {
-			log.Errorf("getCompanyDeveloper: %v", err)
-			return nil, newDbError(err)
+		comIds = append(comIds, dev.CompanyId)
+		devIds = append(devIds, dev.DeveloperId)
+	}
+	comNames, err := a.DbMan.GetComNamesByComIds(uniqueStrings(comIds))
+	if err != nil {
+		log.Errorf("getCompanyDeveloper: %v", err)
+		return nil, newDbError(err)
+	}
+	emails, err := a.DbMan.GetDevEmailsByDevIds(uniqueStrings(devIds))
+	if err != nil {
+		log.Errorf("getCompanyDeveloper: %v", err)
+		return nil, newDbError(err)
+	}
+
+	var details []*CompanyDeveloperDetails
+	for i := range devs {
+		comName, ok := comNames[devs[i].CompanyId]
+		if !ok {
+			err = fmt.Errorf("no company with id=%v", devs[i].CompanyId)
+		}
+		email, ok := emails[devs[i].DeveloperId]
+		if !ok {
+			err = fmt.Errorf("no developer with id=%v", devs[i].DeveloperId)
 		}
-		email, err := a.DbMan.GetDevEmailByDevId(dev.DeveloperId, org)
 		if err != nil {
 			log.Errorf("getCompanyDeveloper: %v", err)
 			return nil, newDbError(err)
 		}
-		detail := makeComDevDetails(&dev, comName[0], email)
-		details = append(details, detail)
+		details = append(details, makeComDevDetails(&devs[i], comName, email))
 	}
 	return &CompanyDevelopersSuccessResponse{
 		CompanyDevelopers:      details,
@@ -286,26 +401,62 @@ func (a *ApiManager) getDeveloper(org string, ids map[string]string) (*Developer
 	if len(devs) == 0 {
 		return nil, ErrNotFound
 	}
-	dev := &devs[0]
+	details, errRes := a.getDeveloperDetails(org, &devs[0])
+	if errRes != nil {
+		return nil, errRes
+	}
+	return &DeveloperSuccessResponse{
+		Developer:              details,
+		Organization:           org,
+		PrimaryIdentifierType:  priKey,
+		PrimaryIdentifierValue: priVal,
+	}, nil
+}
+
+func (a *ApiManager) getDeveloperDetails(org string, dev *common.Developer) (*DeveloperDetails, *common.ErrorResponse) {
+	details, errRes := a.getDevelopersDetails(EndpointDeveloper, org, []common.Developer{*dev})
+	if errRes != nil {
+		return nil, errRes
+	}
+	return details[0], nil
+}
 
-	attrs := a.DbMan.GetKmsAttributes(dev.TenantId, dev.Id)[dev.Id]
-	comNames, err := a.DbMan.GetComNames(dev.Id, TypeDeveloper)
+/*
+ * getDevelopersDetails returns the details of the developers, each kind of related entity being queried once for all of them.
+ * Their secrets are redacted for the requested endpoint, which may inline them in the responses of other entities.
+ */
+func (a *ApiManager) getDevelopersDetails(endpoint, org string, devs []common.Developer) ([]*DeveloperDetails, *common.ErrorResponse) {
+	details := make([]*DeveloperDetails, 0, len(devs))
+	if len(devs) == 0 {
+		return details, nil
+	}
+	devIds := make([]string, len(devs))
+	idsByTenant := make(map[string][]string)
+	for i, dev := range devs {
+		devIds[i] = dev.Id
+		idsByTenant[dev.TenantId] = append(idsByTenant[dev.TenantId], dev.Id)
+	}
+	attrs, errRes := a.getAttributesByTenant(idsByTenant)
+	if errRes != nil {
+		return nil, errRes
+	}
+	comNames, err := a.DbMan.GetComNamesByDevIds(devIds)
 	if err != nil {
 		log.Errorf("getDeveloper: %v", err)
 		return nil, newDbError(err)
 	}
-	appNames, err := a.DbMan.GetAppNames(dev.Id, TypeDeveloper)
+	appNames, err := a.DbMan.GetAppNamesByIds(devIds, TypeDeveloper)
 	if err != nil {
 		log.Errorf("getDeveloper: %v", err)
 		return nil, newDbError(err)
 	}
-	details := makeDevDetails(dev, appNames, comNames, attrs)
-	return &DeveloperSuccessResponse{
-		Developer:              details,
-		Organization:           org,
-		PrimaryIdentifierType:  priKey,
-		PrimaryIdentifierValue: priVal,
-	}, nil
+	for i := range devs {
+		dev := &devs[i]
+		detail := makeDevDetails(dev, appNames[dev.Id], comNames[dev.Id], attrs[dev.Id])
+		detail.Password = a.redact(endpoint, FieldPassword, detail.Password, org)
+		details = append(details, detail)
+	}
+	return details, nil
 }
 
 func (a *ApiManager) getCompany(org string, ids map[string]string) (*CompanySuccessResponse, *common.ErrorResponse) {
@@ -324,15 +475,10 @@ func (a *ApiManager) getCompany(org string, ids map[string]string) (*CompanySucc
 	if len(coms) == 0 {
 		return nil, ErrNotFound
 	}
-	com := &coms[0]
-
-	attrs := a.DbMan.GetKmsAttributes(com.TenantId, com.Id)[com.Id]
-	appNames, err := a.DbMan.GetAppNames(com.Id, TypeCompany)
-	if err != nil {
-		log.Errorf("getCompany: %v", err)
-		return nil, newDbError(err)
+	details, errRes := a.getCompanyDetails(&coms[0])
+	if errRes != nil {
+		return nil, errRes
 	}
-	details := makeCompanyDetails(com, appNames, attrs)
 	return &CompanySuccessResponse{
 		Company:                details,
 		Organization:           org,
@@ -341,7 +487,43 @@ func (a *ApiManager) getCompany(org string, ids map[string]string) (*CompanySucc
 	}, nil
 }
 
-func (a *ApiManager) getApiProduct(org string, ids map[string]string) (*ApiProductSuccessResponse, *common.ErrorResponse) {
+func (a *ApiManager) getCompanyDetails(com *common.Company) (*CompanyDetails, *common.ErrorResponse) {
+	details, errRes := a.getCompaniesDetails([]common.Company{*com})
+	if errRes != nil {
+		return nil, errRes
+	}
+	return details[0], nil
+}
+
+// getCompaniesDetails returns the details of the companies, each kind of related entity being queried once for all of them
+func (a *ApiManager) getCompaniesDetails(coms []common.Company) ([]*CompanyDetails, *common.ErrorResponse) {
+	details := make([]*CompanyDetails, 0, len(coms))
+	if len(coms) == 0 {
+		return details, nil
+	}
+	comIds := make([]string, len(coms))
+	idsByTenant := make(map[string][]string)
+	for i, com := range coms {
+		comIds[i] = com.Id
+		idsByTenant[com.TenantId] = append(idsByTenant[com.TenantId], com.Id)
+	}
+	attrs, errRes := a.getAttributesByTenant(idsByTenant)
+	if errRes != nil {
+		return nil, errRes
+	}
+	appNames, err := a.DbMan.GetAppNamesByIds(comIds, TypeCompany)
+	if err != nil {
+		log.Errorf("getCompany: %v", err)
+		return nil, newDbError(err)
+	}
+	for i := range coms {
+		com := &coms[i]
+		details = append(details, makeCompanyDetails(com, appNames[com.Id], attrs[com.Id]))
+	}
+	return details, nil
+}
+
+func (a *ApiManager) getApiProduct(org string, ids map[string]string, matchedResource, multiple bool) (*ApiProductSuccessResponse, *common.ErrorResponse) {
 	valid, keyVals := parseIdentifiers(EndpointApiProduct, ids)
 	if !valid {
 		return nil, ErrInvalidPar
@@ -356,28 +538,73 @@ func (a *ApiManager) getApiProduct(org string, ids map[string]string) (*ApiProdu
 		return nil, newDbError(err)
 	}
 
-	var attrs []common.Attribute
 	if len(prods) == 0 {
 		return nil, ErrNotFound
 	}
-	prod := &prods[0]
-	attrs = a.DbMan.GetKmsAttributes(prod.TenantId, prod.Id)[prod.Id]
-	details, errRes := makeApiProductDetails(prod, attrs)
-	if errRes != nil {
-		return nil, errRes
-	}
-
-	return &ApiProductSuccessResponse{
-		ApiProduct:               details,
+	res := &ApiProductSuccessResponse{
 		Organization:             org,
 		PrimaryIdentifierType:    priKey,
 		PrimaryIdentifierValue:   priVal,
 		SecondaryIdentifierType:  secKey,
 		SecondaryIdentifierValue: secVal,
-	}, nil
+	}
+	if multiple {
+		details, errRes := a.getApiProductsDetails(prods)
+		if errRes != nil {
+			return nil, errRes
+		}
+		res.ApiProducts = details
+		return res, nil
+	}
+	if len(prods) > 1 && !ManyResultsIdentifiers[EndpointApiProduct][priKey] {
+		candidates := make([]*Candidate, 0, len(prods))
+		for _, prod := range prods {
+			candidates = append(candidates, &Candidate{ID: prod.Id, Name: prod.Name})
+		}
+		return nil, newAmbiguityError(candidates)
+	}
+	prod := &prods[0]
+	details, errRes := a.getApiProductDetails(prod)
+	if errRes != nil {
+		return nil, errRes
+	}
+	res.ApiProduct = details
+	if matchedResource && secKey == IdentifierApiResource {
+		res.MatchedApiResource, _ = a.DbMan.MatchApiResource(prod, secVal)
+	}
+	return res, nil
+}
+
+func (a *ApiManager) getApiProductDetails(prod *common.ApiProduct) (*ApiProductDetails, *common.ErrorResponse) {
+	details, errRes := a.getApiProductsDetails([]common.ApiProduct{*prod})
+	if errRes != nil {
+		return nil, errRes
+	}
+	return details[0], nil
 }
 
-func (a *ApiManager) getAppCredential(org string, ids map[string]string) (*AppCredentialSuccessResponse, *common.ErrorResponse) {
+// getApiProductsDetails returns the details of the apiproducts, their attributes being queried once for all of them
+func (a *ApiManager) getApiProductsDetails(prods []common.ApiProduct) ([]*ApiProductDetails, *common.ErrorResponse) {
+	idsByTenant := make(map[string][]string)
+	for _, prod := range prods {
+		idsByTenant[prod.TenantId] = append(idsByTenant[prod.TenantId], prod.Id)
+	}
+	attrs, errRes := a.getAttributesByTenant(idsByTenant)
+	if errRes != nil {
+		return nil, errRes
+	}
+	details := make([]*ApiProductDetails, 0, len(prods))
+	for i := range prods {
+		detail, errRes := makeApiProductDetails(&prods[i], attrs[prods[i].Id])
+		if errRes != nil {
+			return nil, errRes
+		}
+		details = append(details, detail)
+	}
+	return details, nil
+}
+
+func (a *ApiManager) getAppCredential(org string, ids map[string]string, multiple bool, expand expansion) (*AppCredentialSuccessResponse, *common.ErrorResponse) {
 	valid, keyVals := parseIdentifiers(EndpointApiProduct, ids)
 	if !valid {
 		return nil, ErrInvalidPar
@@ -393,45 +620,85 @@ func (a *ApiManager) getAppCredential(org string, ids map[string]string) (*AppCr
 	if len(appCreds) == 0 {
 		return nil, ErrNotFound
 	}
-	appCred := &appCreds[0]
-	attrs := a.DbMan.GetKmsAttributes(appCred.TenantId, appCred.Id)[appCred.Id]
+	res := &AppCredentialSuccessResponse{
+		Organization:           org,
+		PrimaryIdentifierType:  priKey,
+		PrimaryIdentifierValue: priVal,
+	}
+	if multiple {
+		var apps []*common.App
+		for i := range appCreds {
+			details, app, errRes := a.getAppCredentialDetails(org, &appCreds[i])
+			if errRes != nil {
+				return nil, errRes
+			}
+			if details != nil {
+				res.AppCredentials = append(res.AppCredentials, details)
+				apps = append(apps, app)
+			}
+		}
+		if errRes := a.expandAppCredentials(org, apps, res.AppCredentials, expand); errRes != nil {
+			return nil, errRes
+		}
+		return res, nil
+	}
+	if len(appCreds) > 1 {
+		candidates := make([]*Candidate, 0, len(appCreds))
+		for _, appCred := range appCreds {
+			candidates = append(candidates, &Candidate{ID: appCred.Id, ParentType: ParentTypeApp, Parent: appCred.AppId})
+		}
+		return nil, newAmbiguityError(candidates)
+	}
+	details, app, errRes := a.getAppCredentialDetails(org, &appCreds[0])
+	if errRes != nil {
+		return nil, errRes
+	}
+	if details == nil {
+		return &AppCredentialSuccessResponse{
+			AppCredential: nil,
+			Organization:  org,
+		}, nil
+	}
+	if errRes := a.expandAppCredentials(org, []*common.App{app}, []*AppCredentialDetails{details}, expand); errRes != nil {
+		return nil, errRes
+	}
+	res.AppCredential = details
+	return res, nil
+}
+
+// getAppCredentialDetails returns the details of the credential and its app, nil if the app does not exist
+func (a *ApiManager) getAppCredentialDetails(org string, appCred *common.AppCredential) (*AppCredentialDetails, *common.App, *common.ErrorResponse) {
 	apps, err := a.DbMan.GetApps(org, IdentifierAppId, appCred.AppId, "", "")
 	if err != nil {
 		log.Errorf("getAppCredential: %v", err)
-		return nil, newDbError(err)
+		return nil, nil, newDbError(err)
 	}
 
 	if len(apps) == 0 {
 		log.Errorf("getAppCredential: No App with id=%v", appCred.AppId)
-		return &AppCredentialSuccessResponse{
-			AppCredential: nil,
-			Organization:  org,
-		}, nil
+		return nil, nil, nil
 	}
 	app := &apps[0]
 	cd, errRes := a.getCredDetails(appCred, app.Status)
 	if errRes != nil {
-		return nil, errRes
+		return nil, nil, errRes
 	}
 	devStatus := ""
 	if app.DeveloperId != "" {
 		devStatus, err = a.DbMan.GetStatus(app.DeveloperId, AppTypeDeveloper)
 		if err != nil {
 			log.Errorf("getAppCredential error get status: %v", err)
-			return nil, newDbError(err)
+			return nil, nil, newDbError(err)
 		}
 	}
+	cd.ConsumerSecret = a.redact(EndpointAppCredentials, FieldConsumerSecret, cd.ConsumerSecret, org)
 	cks := makeConsumerKeyStatusDetails(app, cd, devStatus)
-	details := makeAppCredentialDetails(appCred, cks, []string{app.CallbackUrl}, attrs)
-	return &AppCredentialSuccessResponse{
-		AppCredential:          details,
-		Organization:           org,
-		PrimaryIdentifierType:  priKey,
-		PrimaryIdentifierValue: priVal,
-	}, nil
+	details := makeAppCredentialDetails(appCred, cks, []string{app.CallbackUrl}, cd.Attributes)
+	details.ConsumerSecret = cd.ConsumerSecret
+	return details, app, nil
 }
 
-func (a *ApiManager) getApp(org string, ids map[string]string) (*AppSuccessResponse, *common.ErrorResponse) {
+func (a *ApiManager) getApp(org string, ids map[string]string, multiple bool, expand expansion) (*AppSuccessResponse, *common.ErrorResponse) {
 	valid, keyVals := parseIdentifiers(EndpointApp, ids)
 	if !valid {
 		return nil, ErrInvalidPar
@@ -447,73 +714,150 @@ func (a *ApiManager) getApp(org string, ids map[string]string) (*AppSuccessRespo
 		return nil, newDbError(err)
 	}
 
-	var app *common.App
-	var attrs []common.Attribute
-
 	if len(apps) == 0 {
 		return nil, ErrNotFound
 	}
+	res := &AppSuccessResponse{
+		Organization:             org,
+		PrimaryIdentifierType:    priKey,
+		PrimaryIdentifierValue:   priVal,
+		SecondaryIdentifierType:  secKey,
+		SecondaryIdentifierValue: secVal,
+	}
+	if multiple {
+		details, errRes := a.getAppsDetails(org, apps)
+		if errRes != nil {
+			return nil, errRes
+		}
+		res.Apps = details
+		if errRes := a.expandApps(org, apps, res.Apps, expand); errRes != nil {
+			return nil, errRes
+		}
+		return res, nil
+	}
+	if len(apps) > 1 {
+		// apps of the same name under several developers or companies
+		comIds := make([]string, 0, len(apps))
+		for _, app := range apps {
+			if app.Type == AppTypeCompany {
+				comIds = append(comIds, app.ParentId)
+			}
+		}
+		comNames, err := a.DbMan.GetComNamesByComIds(uniqueStrings(comIds))
+		if err != nil {
+			log.Errorf("getApp error getting parent name: %v", err)
+			return nil, newDbError(err)
+		}
+		candidates := make([]*Candidate, 0, len(apps))
+		for _, app := range apps {
+			var parent string
+			switch app.Type {
+			case AppTypeDeveloper:
+				parent = app.ParentId
+			case AppTypeCompany:
+				if parent = comNames[app.ParentId]; parent == "" {
+					log.Warnf("getApp: No company with id=%v", app.ParentId)
+				}
+			}
+			candidates = append(candidates, &Candidate{ID: app.Id, Name: app.Name, ParentType: app.Type, Parent: parent})
+		}
+		return nil, newAmbiguityError(candidates)
+	}
+	details, errRes := a.getAppsDetails(org, apps)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if errRes := a.expandApps(org, apps, details, expand); errRes != nil {
+		return nil, errRes
+	}
+	res.App = details[0]
+	return res, nil
+}
 
-	app = &apps[0]
-	attrs = a.DbMan.GetKmsAttributes(app.TenantId, app.Id)[app.Id]
-	prods, err := a.DbMan.GetApiProductNames(app.Id, TypeApp)
+/*
+ * getAppsDetails returns the details of the apps. Each kind of related entity is queried once for all the apps,
+ * so that the number of queries does not grow with the number of apps or credentials.
+ */
+func (a *ApiManager) getAppsDetails(org string, apps []common.App) ([]*AppDetails, *common.ErrorResponse) {
+	details := make([]*AppDetails, 0, len(apps))
+	if len(apps) == 0 {
+		return details, nil
+	}
+	appIds := make([]string, len(apps))
+	appStatuses := make(map[string]string, len(apps))
+	parentIds := make(map[string][]string)
+	idsByTenant := make(map[string][]string)
+	for i, app := range apps {
+		appIds[i] = app.Id
+		appStatuses[app.Id] = app.Status
+		parentIds[app.Type] = append(parentIds[app.Type], app.ParentId)
+		idsByTenant[app.TenantId] = append(idsByTenant[app.TenantId], app.Id)
+	}
+	attrs, errRes := a.getAttributesByTenant(idsByTenant)
+	if errRes != nil {
+		return nil, errRes
+	}
+	prods, err := a.DbMan.GetApiProductNamesByIds(appIds, TypeApp)
 	if err != nil {
 		log.Errorf("getApp error getting productNames: %v", err)
 		return nil, newDbError(err)
 	}
-	parStatus, err := a.DbMan.GetStatus(app.ParentId, app.Type)
+	parStatuses := make(map[string]map[string]string)
+	for parentType, ids := range parentIds {
+		if parStatuses[parentType], err = a.DbMan.GetStatuses(uniqueStrings(ids), parentType); err != nil {
+			log.Errorf("getApp error getting parent status: %v", err)
+			return nil, newDbError(err)
+		}
+	}
+	comNames, err := a.DbMan.GetComNamesByComIds(uniqueStrings(parentIds[AppTypeCompany]))
 	if err != nil {
-		log.Errorf("getApp error getting parent status: %v", err)
+		log.Errorf("getApp error getting parent name: %v", err)
 		return nil, newDbError(err)
 	}
-	creds, err := a.DbMan.GetAppCredentials(org, IdentifierAppId, app.Id, "", "")
+	creds, err := a.DbMan.GetAppCredentialsByAppIds(org, appIds)
 	if err != nil {
-		log.Errorf("getApp error getting parent status: %v", err)
+		log.Errorf("getApp error getting credentials: %v", err)
 		return nil, newDbError(err)
 	}
-	var credDetails []*CredentialDetails
-	for _, cred := range creds {
-		detail, errRes := a.getCredDetails(&cred, app.Status)
-		if errRes != nil {
-			return nil, errRes
-		}
-		credDetails = append(credDetails, detail)
-	}
-
-	parent, errRes := a.getAppParent(app.ParentId, app.Type)
+	credDetails, errRes := a.getCredsDetails(creds, appStatuses)
 	if errRes != nil {
 		return nil, errRes
 	}
-	details, errRes := makeAppDetails(app, parent, parStatus, prods, credDetails, attrs)
-	if errRes != nil {
-		return nil, errRes
+	credsByApp := make(map[string][]*CredentialDetails)
+	for _, cd := range credDetails {
+		cd.ConsumerSecret = a.redact(EndpointApp, FieldConsumerSecret, cd.ConsumerSecret, org)
+		credsByApp[cd.AppID] = append(credsByApp[cd.AppID], cd)
 	}
-	return &AppSuccessResponse{
-		App:                      details,
-		Organization:             org,
-		PrimaryIdentifierType:    priKey,
-		PrimaryIdentifierValue:   priVal,
-		SecondaryIdentifierType:  secKey,
-		SecondaryIdentifierValue: secVal,
-	}, nil
-}
 
-func (a *ApiManager) getAppParent(id string, parentType string) (string, *common.ErrorResponse) {
-	switch parentType {
-	case AppTypeDeveloper:
-		return id, nil
-	case AppTypeCompany:
-		names, err := a.DbMan.GetComNames(id, TypeCompany)
-		if err != nil {
-			return "", newDbError(err)
+	for i := range apps {
+		app := &apps[i]
+		parent := app.ParentId
+		if app.Type == AppTypeCompany {
+			if parent = comNames[app.ParentId]; parent == "" {
+				log.Warnf("getApp: No company with id=%v", app.ParentId)
+			}
 		}
-		if len(names) == 0 {
-			log.Warnf("getAppParent: No company with id=%v", id)
-			return "", nil
+		detail, errRes := makeAppDetails(app, parent, parStatuses[app.Type][app.ParentId], prods[app.Id], credsByApp[app.Id], attrs[app.Id])
+		if errRes != nil {
+			return nil, errRes
 		}
-		return names[0], nil
+		details = append(details, detail)
+	}
+	return details, nil
+}
+
+// getAttributes returns the attributes of the entity
+func (a *ApiManager) getAttributes(tenantId, id string) ([]common.Attribute, *common.ErrorResponse) {
+	attrs, err := a.DbMan.GetKmsAttributes(tenantId, id)
+	if err != nil {
+		log.Errorf("getAttributes: %v", err)
+		return nil, newDbError(err)
 	}
-	return "", nil
+	return attrs[id], nil
+}
+
+func (a *ApiManager) redact(endpoint, field, value, org string) string {
+	return a.Redaction.redact(endpoint, field, value, org, a.CipherManager)
 }
 
 func makeConsumerKeyStatusDetails(app *common.App, c *CredentialDetails, devStatus string) *ConsumerKeyStatusDetails {
@@ -656,25 +1000,75 @@ func makeComDevDetails(comDev *common.CompanyDeveloper, comName, devEmail string
 }
 
 func (a *ApiManager) getCredDetails(cred *common.AppCredential, appStatus string) (*CredentialDetails, *common.ErrorResponse) {
+	details, errRes := a.getCredsDetails([]common.AppCredential{*cred}, map[string]string{cred.AppId: appStatus})
+	if errRes != nil {
+		return nil, errRes
+	}
+	return details[0], nil
+}
 
-	refs, err := a.DbMan.GetApiProductNames(cred.Id, TypeConsumerKey)
+// getCredsDetails returns the details of the credentials, appStatuses holding the status of their apps by id
+func (a *ApiManager) getCredsDetails(creds []common.AppCredential, appStatuses map[string]string) ([]*CredentialDetails, *common.ErrorResponse) {
+	keys := make([]string, len(creds))
+	idsByTenant := make(map[string][]string)
+	for i, cred := range creds {
+		keys[i] = cred.Id
+		idsByTenant[cred.TenantId] = append(idsByTenant[cred.TenantId], cred.Id)
+	}
+	mappings, err := a.DbMan.GetApiProductReferences(keys)
 	if err != nil {
 		log.Errorf("Error when getting product reference list")
 		return nil, newDbError(err)
 	}
-	return &CredentialDetails{
-		ApiProductReferences: refs,
-		AppID:                cred.AppId,
-		AppStatus:            appStatus,
-		Attributes:           a.DbMan.GetKmsAttributes(cred.TenantId, cred.Id)[cred.Id],
-		ConsumerKey:          cred.Id,
-		ConsumerSecret:       cred.ConsumerSecret,
-		ExpiresAt:            cred.ExpiresAt,
-		IssuedAt:             cred.IssuedAt,
-		MethodType:           cred.MethodType,
-		Scopes:               common.JsonToStringArray(cred.Scopes),
-		Status:               cred.Status,
-	}, nil
+	refs := make(map[string][]*ApiProductReferenceDetails)
+	for _, m := range mappings {
+		refs[m.ConsumerKey] = append(refs[m.ConsumerKey], &ApiProductReferenceDetails{
+			ApiProduct: m.Name,
+			Status:     m.Status,
+			nameOnly:   a.LegacyProductReferences,
+		})
+	}
+	attrs, errRes := a.getAttributesByTenant(idsByTenant)
+	if errRes != nil {
+		return nil, errRes
+	}
+	details := make([]*CredentialDetails, 0, len(creds))
+	for _, cred := range creds {
+		details = append(details, &CredentialDetails{
+			ApiProductReferences: refs[cred.Id],
+			AppID:                cred.AppId,
+			AppStatus:            appStatuses[cred.AppId],
+			Attributes:           attrs[cred.Id],
+			ConsumerKey:          cred.Id,
+			ConsumerSecret:       cred.ConsumerSecret,
+			ExpiresAt:            cred.ExpiresAt,
+			IssuedAt:             cred.IssuedAt,
+			MethodType:           cred.MethodType,
+			Scopes:               common.JsonToStringArray(cred.Scopes),
+			Status:               cred.Status,
+		})
+	}
+	return details, nil
+}
+
+// MarshalJSON returns the name of the api product only for the legacy shape of references
+func (r *ApiProductReferenceDetails) MarshalJSON() ([]byte, error) {
+	if r.nameOnly {
+		return json.Marshal(r.ApiProduct)
+	}
+	type plain ApiProductReferenceDetails
+	return json.Marshal((*plain)(r))
+}
+
+// UnmarshalJSON accepts both shapes of references
+func (r *ApiProductReferenceDetails) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*r = ApiProductReferenceDetails{ApiProduct: name, nameOnly: true}
+		return nil
+	}
+	type plain ApiProductReferenceDetails
+	return json.Unmarshal(b, (*plain)(r))
 }
 
 func parseIdentifiers(endpoint string, ids map[string]string) (valid bool, keyVals []string) {
@@ -709,6 +1103,15 @@ func newDbError(err error) *common.ErrorResponse {
 	}
 }
 
+func newAmbiguityError(candidates []*Candidate) *common.ErrorResponse {
+	return &common.ErrorResponse{
+		ResponseCode:    strconv.Itoa(AMBIGUOUS_IDENTIFIERS),
+		ResponseMessage: fmt.Sprintf("Identifiers match %d entities, add a secondary identifier or set %s=true", len(candidates), ParameterMultiple),
+		StatusCode:      http.StatusConflict,
+		Details:         &AmbiguityDetails{Candidates: candidates},
+	}
+}
+
 func newDataError(err error) *common.ErrorResponse {
 	return &common.ErrorResponse{
 		ResponseCode:    strconv.Itoa(DATA_ERROR),
@@ -19,6 +19,8 @@ import "github.com/apid/apidApiMetadata/common"
 type ApiProductSuccessResponse struct {
 	// api product
 	ApiProduct *ApiProductDetails `json:"apiProduct"`
+	// all matching api products instead of apiProduct, if multiple were requested
+	ApiProducts []*ApiProductDetails `json:"apiProducts,omitempty"`
 	// Organization Identifier/Name
 	Organization string `json:"organization"`
 	// primary identifier type
@@ -29,11 +31,15 @@ type ApiProductSuccessResponse struct {
 	SecondaryIdentifierType string `json:"secondaryIdentifierType"`
 	// secondary identifier value
 	SecondaryIdentifierValue string `json:"secondaryIdentifierValue"`
+	// api resource matching the apiresource identifier, if requested
+	MatchedApiResource string `json:"matchedApiResource,omitempty"`
 }
 
 type AppCredentialSuccessResponse struct {
 	// app credential
 	AppCredential *AppCredentialDetails `json:"appCredential"`
+	// all matching app credentials instead of appCredential, if multiple were requested
+	AppCredentials []*AppCredentialDetails `json:"appCredentials,omitempty"`
 	// Organization Identifier/Name
 	Organization string `json:"organization"`
 	// primary identifier type
@@ -45,6 +51,8 @@ type AppCredentialSuccessResponse struct {
 type AppSuccessResponse struct {
 	// app
 	App *AppDetails `json:"app"`
+	// all matching apps instead of app, if multiple were requested
+	Apps []*AppDetails `json:"apps,omitempty"`
 	// Organization Identifier/Name
 	Organization string `json:"organization"`
 	// primary identifier type
@@ -163,11 +171,13 @@ type AppDetails struct {
 	Name string `json:"name"`
 	// status
 	Status string `json:"status"`
+	// related entities inlined as requested by the expand parameter
+	Expanded *ExpandedDetails `json:"expanded,omitempty"`
 }
 
 type CredentialDetails struct {
-	// api product references
-	ApiProductReferences []string `json:"apiProductReferences"`
+	// api product references, with the approval status of the consumer key for each of them
+	ApiProductReferences []*ApiProductReferenceDetails `json:"apiProductReferences"`
 	// app Id
 	AppID string `json:"appId"`
 	// app status
@@ -177,7 +187,7 @@ type CredentialDetails struct {
 	// consumer key
 	ConsumerKey string `json:"consumerKey"`
 	// consumer secret
-	ConsumerSecret string `json:"consumerSecret"`
+	ConsumerSecret string `json:"consumerSecret,omitempty"`
 	// expires at
 	ExpiresAt string `json:"expiresAt"`
 	// issued at
@@ -190,14 +200,16 @@ type CredentialDetails struct {
 	Status string `json:"status"`
 }
 
-/*
+// ApiProductReferenceDetails are marshalled as the name of the api product only if nameOnly is set, see ApiManager
 type ApiProductReferenceDetails struct {
-	// status of the api product
-	Status         string `json:"status"`
+	// approval status of the consumer key for the api product
+	Status string `json:"status"`
 	// name of the api product
 	ApiProduct string `json:"apiProduct"`
+	// set for the legacy shape of references
+	nameOnly bool
 }
-*/
+
 type AppCredentialDetails struct {
 	// app Id
 	AppID string `json:"appId"`
@@ -210,7 +222,7 @@ type AppCredentialDetails struct {
 	// consumer key status
 	ConsumerKeyStatus *ConsumerKeyStatusDetails `json:"consumerKeyStatus"`
 	// consumer secret
-	ConsumerSecret string `json:"consumerSecret"`
+	ConsumerSecret string `json:"consumerSecret,omitempty"`
 	// developer Id
 	DeveloperID string `json:"developerId"`
 	// redirect uris
@@ -219,6 +231,8 @@ type AppCredentialDetails struct {
 	Scopes []string `json:"scopes"`
 	// status
 	Status string `json:"status"`
+	// related entities inlined as requested by the expand parameter
+	Expanded *ExpandedDetails `json:"expanded,omitempty"`
 }
 
 type ConsumerKeyStatusDetails struct {
@@ -305,9 +319,90 @@ type DeveloperDetails struct {
 	// last name
 	LastName string `json:"lastName"`
 	// password
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
 	// status
 	Status string `json:"status"`
 	// user name
 	UserName string `json:"userName"`
 }
+
+type ApiProductsSuccessResponse struct {
+	// api products of the page
+	ApiProducts []*ApiProductDetails `json:"apiProducts"`
+	// Organization Identifier/Name
+	Organization string `json:"organization"`
+	// identifier filtering the list, empty if the list holds all the entities of the org
+	PrimaryIdentifierType string `json:"primaryIdentifierType,omitempty"`
+	// value of the identifier filtering the list
+	PrimaryIdentifierValue string `json:"primaryIdentifierValue,omitempty"`
+	// token of the next page, empty on the last page
+	Continuation string `json:"continuation,omitempty"`
+}
+
+type AppsSuccessResponse struct {
+	// apps of the page
+	Apps []*AppDetails `json:"apps"`
+	// Organization Identifier/Name
+	Organization string `json:"organization"`
+	// identifier filtering the list, empty if the list holds all the entities of the org
+	PrimaryIdentifierType string `json:"primaryIdentifierType,omitempty"`
+	// value of the identifier filtering the list
+	PrimaryIdentifierValue string `json:"primaryIdentifierValue,omitempty"`
+	// token of the next page, empty on the last page
+	Continuation string `json:"continuation,omitempty"`
+}
+
+type CompaniesSuccessResponse struct {
+	// companies of the page
+	Companies []*CompanyDetails `json:"companies"`
+	// Organization Identifier/Name
+	Organization string `json:"organization"`
+	// identifier filtering the list, empty if the list holds all the entities of the org
+	PrimaryIdentifierType string `json:"primaryIdentifierType,omitempty"`
+	// value of the identifier filtering the list
+	PrimaryIdentifierValue string `json:"primaryIdentifierValue,omitempty"`
+	// token of the next page, empty on the last page
+	Continuation string `json:"continuation,omitempty"`
+}
+
+type DevelopersSuccessResponse struct {
+	// developers of the page
+	Developers []*DeveloperDetails `json:"developers"`
+	// Organization Identifier/Name
+	Organization string `json:"organization"`
+	// identifier filtering the list, empty if the list holds all the entities of the org
+	PrimaryIdentifierType string `json:"primaryIdentifierType,omitempty"`
+	// value of the identifier filtering the list
+	PrimaryIdentifierValue string `json:"primaryIdentifierValue,omitempty"`
+	// token of the next page, empty on the last page
+	Continuation string `json:"continuation,omitempty"`
+}
+
+// AmbiguityDetails are the details of the error returned when the identifiers match several entities
+type AmbiguityDetails struct {
+	// entities matching the identifiers
+	Candidates []*Candidate `json:"candidates"`
+}
+
+type Candidate struct {
+	// id of the entity, the consumer key of app credentials
+	ID string `json:"id"`
+	// name of the entity
+	Name string `json:"name,omitempty"`
+	// DEVELOPER or COMPANY for apps, APP for app credentials
+	ParentType string `json:"parentType,omitempty"`
+	// developer id or company name of apps, app id of app credentials
+	Parent string `json:"parent,omitempty"`
+}
+
+// ExpandedDetails are the related entities of an app or app credential, each present only if expanded
+type ExpandedDetails struct {
+	// api products of the app, or of the app credential
+	ApiProducts []*ApiProductDetails `json:"apiProducts,omitempty"`
+	// developer of the app
+	Developer *DeveloperDetails `json:"developer,omitempty"`
+	// company of the app
+	Company *CompanyDetails `json:"company,omitempty"`
+	// credentials of the app
+	Credentials []*AppCredentialDetails `json:"credentials,omitempty"`
+}
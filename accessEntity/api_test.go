@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -162,6 +163,27 @@ var _ = Describe("API Tests", func() {
 			}
 		}
 
+		// matched resource
+		dbMan.apiProducts = testProd
+		pars := map[string][]string{
+			IdentifierOrganization:   {"test-org"},
+			IdentifierAppId:          {"test-app"},
+			IdentifierApiResource:    {"/v1/orders/123"},
+			ParameterMatchedResource: {"true"},
+		}
+		code, body := clientGet(apiMan.AccessEntityPath+EndpointApiProduct, pars)
+		Expect(code).Should(Equal(http.StatusOK))
+		var res ApiProductSuccessResponse
+		Expect(json.Unmarshal(body, &res)).Should(Succeed())
+		Expect(res.SecondaryIdentifierValue).Should(Equal("/v1/orders/123"))
+		Expect(res.MatchedApiResource).Should(Equal("/**"))
+
+		delete(pars, ParameterMatchedResource)
+		code, body = clientGet(apiMan.AccessEntityPath+EndpointApiProduct, pars)
+		Expect(code).Should(Equal(http.StatusOK))
+		res = ApiProductSuccessResponse{}
+		Expect(json.Unmarshal(body, &res)).Should(Succeed())
+		Expect(res.MatchedApiResource).Should(BeEmpty())
 	})
 
 	It("Apps", func() {
@@ -208,6 +230,10 @@ var _ = Describe("API Tests", func() {
 		}
 
 		testProductNames := []string{"foo", "bar"}
+		testProductRefs := []*ApiProductReferenceDetails{
+			{ApiProduct: "foo", Status: dummyReferenceStatus},
+			{ApiProduct: "bar", Status: dummyReferenceStatus},
+		}
 		testStatus := "test-status"
 		testCreds := []common.AppCredential{
 			{
@@ -233,7 +259,7 @@ var _ = Describe("API Tests", func() {
 				ApiProducts: testProductNames,
 				AppCredentials: []*CredentialDetails{
 					{
-						ApiProductReferences: testProductNames,
+						ApiProductReferences: testProductRefs,
 						AppID:                testCreds[0].AppId,
 						AppStatus:            testApp[0].Status,
 						Attributes:           attrs,
@@ -274,7 +300,7 @@ var _ = Describe("API Tests", func() {
 				ApiProducts: testProductNames,
 				AppCredentials: []*CredentialDetails{
 					{
-						ApiProductReferences: testProductNames,
+						ApiProductReferences: testProductRefs,
 						AppID:                testCreds[0].AppId,
 						AppStatus:            testComApp[0].Status,
 						Attributes:           attrs,
@@ -587,6 +613,10 @@ var _ = Describe("API Tests", func() {
 		}
 
 		testProductNames := []string{"foo", "bar"}
+		testProductRefs := []*ApiProductReferenceDetails{
+			{ApiProduct: "foo", Status: dummyReferenceStatus},
+			{ApiProduct: "bar", Status: dummyReferenceStatus},
+		}
 		testStatus := "test-status"
 
 		expected := AppCredentialSuccessResponse{
@@ -597,7 +627,7 @@ var _ = Describe("API Tests", func() {
 				ConsumerKey: testAppCred[0].Id,
 				ConsumerKeyStatus: &ConsumerKeyStatusDetails{
 					AppCredential: &CredentialDetails{
-						ApiProductReferences: testProductNames,
+						ApiProductReferences: testProductRefs,
 						AppID:                testAppCred[0].AppId,
 						AppStatus:            testApp[0].Status,
 						Attributes:           attrs,
@@ -758,6 +788,535 @@ var _ = Describe("API Tests", func() {
 		}
 
 	})
+
+	Context("Ambiguity", func() {
+		BeforeEach(func() {
+			dbMan.apps = []common.App{
+				{Id: testId, Name: "apstest", Status: "APPROVED", DeveloperId: "dev1", ParentId: "dev1", Type: AppTypeDeveloper},
+				{Id: testId + "-2", Name: "apstest", Status: "APPROVED", DeveloperId: "dev2", ParentId: "dev2", Type: AppTypeDeveloper},
+			}
+			dbMan.apiProducts = []common.ApiProduct{
+				{Id: testId, Name: "prod1", ApiResources: "{/**}", Scopes: "{}", Proxies: "{}", Environments: "{}"},
+				{Id: testId + "-2", Name: "prod2", ApiResources: "{/**}", Scopes: "{}", Proxies: "{}", Environments: "{}"},
+			}
+			dbMan.appCredentials = []common.AppCredential{
+				{Id: "key1", AppId: testId, Status: "APPROVED", Scopes: "{}"},
+				{Id: "key2", AppId: testId + "-2", Status: "APPROVED", Scopes: "{}"},
+			}
+		})
+
+		It("should report the candidates of ambiguous identifiers", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppName:      {"apstest"},
+			})
+			Expect(code).Should(Equal(http.StatusConflict))
+			candidates := func(body []byte) []*Candidate {
+				var res struct {
+					common.ErrorResponse
+					Details AmbiguityDetails `json:"details"`
+				}
+				Expect(json.Unmarshal(body, &res)).Should(Succeed())
+				Expect(res.ResponseCode).Should(Equal(strconv.Itoa(AMBIGUOUS_IDENTIFIERS)))
+				return res.Details.Candidates
+			}
+			Expect(candidates(body)).Should(Equal([]*Candidate{
+				{ID: testId, Name: "apstest", ParentType: AppTypeDeveloper, Parent: "dev1"},
+				{ID: testId + "-2", Name: "apstest", ParentType: AppTypeDeveloper, Parent: "dev2"},
+			}))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointApiProduct, map[string][]string{
+				IdentifierOrganization:   {"test-org"},
+				IdentifierApiProductName: {"prod1"},
+			})
+			Expect(code).Should(Equal(http.StatusConflict))
+			Expect(candidates(body)).Should(Equal([]*Candidate{
+				{ID: testId, Name: "prod1"},
+				{ID: testId + "-2", Name: "prod2"},
+			}))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierConsumerKey:  {"key1"},
+			})
+			Expect(code).Should(Equal(http.StatusConflict))
+			Expect(candidates(body)).Should(Equal([]*Candidate{
+				{ID: "key1", ParentType: ParentTypeApp, Parent: testId},
+				{ID: "key2", ParentType: ParentTypeApp, Parent: testId + "-2"},
+			}))
+		})
+
+		It("should name the company of company apps among the candidates", func() {
+			dbMan.apps[1] = common.App{Id: testId + "-2", Name: "apstest", Status: "APPROVED", CompanyId: "com2", ParentId: "com2", Type: AppTypeCompany}
+			dbMan.comNames = []string{"company2"}
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppName:      {"apstest"},
+			})
+			Expect(code).Should(Equal(http.StatusConflict))
+			var res struct {
+				common.ErrorResponse
+				Details AmbiguityDetails `json:"details"`
+			}
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.Details.Candidates).Should(Equal([]*Candidate{
+				{ID: testId, Name: "apstest", ParentType: AppTypeDeveloper, Parent: "dev1"},
+				{ID: testId + "-2", Name: "apstest", ParentType: AppTypeCompany, Parent: "company2"},
+			}))
+		})
+
+		It("should return the first apiproduct of an app", func() {
+			for _, id := range []string{IdentifierAppId, IdentifierConsumerKey} {
+				code, body := clientGet(apiMan.AccessEntityPath+EndpointApiProduct, map[string][]string{
+					IdentifierOrganization: {"test-org"},
+					id:                     {testId},
+				})
+				Expect(code).Should(Equal(http.StatusOK), id)
+				var res ApiProductSuccessResponse
+				Expect(json.Unmarshal(body, &res)).Should(Succeed())
+				Expect(res.ApiProduct.Name).Should(Equal("prod1"))
+				Expect(res.ApiProducts).Should(BeEmpty())
+			}
+		})
+
+		It("should return all matches if multiple are requested", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppName:      {"apstest"},
+				ParameterMultiple:      {"true"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var appRes AppSuccessResponse
+			Expect(json.Unmarshal(body, &appRes)).Should(Succeed())
+			Expect(appRes.App).Should(BeNil())
+			Expect(appRes.Apps).Should(HaveLen(2))
+			Expect(appRes.Apps[1].AppParentID).Should(Equal("dev2"))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointApiProduct, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppId:        {testId},
+				ParameterMultiple:      {"true"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var prodRes ApiProductSuccessResponse
+			Expect(json.Unmarshal(body, &prodRes)).Should(Succeed())
+			Expect(prodRes.ApiProducts).Should(HaveLen(2))
+			Expect(prodRes.ApiProducts[0].Name).Should(Equal("prod1"))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierConsumerKey:  {"key1"},
+				ParameterMultiple:      {"true"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var credRes AppCredentialSuccessResponse
+			Expect(json.Unmarshal(body, &credRes)).Should(Succeed())
+			Expect(credRes.AppCredentials).Should(HaveLen(2))
+			Expect(credRes.AppCredentials[1].ConsumerKey).Should(Equal("key2"))
+		})
+	})
+
+	Context("List", func() {
+		BeforeEach(func() {
+			dbMan.developers = []common.Developer{
+				{Id: testId, Email: "bar@google.com"},
+				{Id: testId + "-2", Email: "foo@google.com"},
+			}
+		})
+
+		It("should list a page of developers", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointDeveloper, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				ParameterLimit:         {"1"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var res DevelopersSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.Developers).Should(HaveLen(1))
+			Expect(res.Developers[0].ID).Should(Equal(testId))
+			Expect(res.Developers[0].Attributes).Should(Equal(attrs))
+			Expect(res.Organization).Should(Equal("test-org"))
+			Expect(res.Continuation).ShouldNot(BeEmpty())
+
+			// the token only continues the same list
+			code, _ = clientGet(apiMan.AccessEntityPath+EndpointDeveloper, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierCompanyName:  {"test-company"},
+				ParameterContinuation:  {res.Continuation},
+			})
+			Expect(code).Should(Equal(http.StatusBadRequest))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointDeveloper, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				ParameterContinuation:  {res.Continuation},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var last DevelopersSuccessResponse
+			Expect(json.Unmarshal(body, &last)).Should(Succeed())
+			Expect(last.Developers).Should(HaveLen(2))
+			Expect(last.Continuation).Should(BeEmpty())
+		})
+
+		It("should list the apps of a developer", func() {
+			dbMan.apps = []common.App{
+				{Id: testId, Name: "apstest", Status: "APPROVED", DeveloperId: "dev", ParentId: "dev", Type: AppTypeDeveloper},
+			}
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierDeveloperId:  {"dev"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppsSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.Apps).Should(HaveLen(1))
+			Expect(res.Apps[0].Name).Should(Equal("apstest"))
+			Expect(res.PrimaryIdentifierType).Should(Equal(IdentifierDeveloperId))
+			Expect(res.PrimaryIdentifierValue).Should(Equal("dev"))
+			Expect(res.Continuation).Should(BeEmpty())
+		})
+
+		It("should return an empty list", func() {
+			dbMan.apiProducts = nil
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApiProduct, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(body).Should(MatchJSON(`{"apiProducts": [], "organization": "test-org"}`))
+		})
+
+		It("should reject invalid pages", func() {
+			for _, pars := range []map[string][]string{
+				{ParameterLimit: {"0"}},
+				{ParameterLimit: {"1001"}},
+				{ParameterLimit: {"ten"}},
+				{ParameterContinuation: {"not-a-token"}},
+			} {
+				pars[IdentifierOrganization] = []string{"test-org"}
+				code, _ := clientGet(apiMan.AccessEntityPath+EndpointCompany, pars)
+				Expect(code).Should(Equal(http.StatusBadRequest))
+			}
+		})
+
+		It("should not list without an organization", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointCompany, nil)
+			Expect(code).Should(Equal(http.StatusBadRequest))
+			var res common.ErrorResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.ResponseCode).Should(Equal(strconv.Itoa(INVALID_PARAMETERS)))
+		})
+	})
+
+	Context("Product references", func() {
+		BeforeEach(func() {
+			dbMan.apps = []common.App{
+				{Id: testId, Name: "apstest", Status: "APPROVED", DeveloperId: "dev", ParentId: "dev", Type: AppTypeDeveloper},
+			}
+			dbMan.appCredentials = []common.AppCredential{
+				{Id: "key1", AppId: testId, Status: "APPROVED", Scopes: "{}"},
+			}
+			dbMan.apiProductNames = []string{"prod1"}
+		})
+		refs := func(body []byte) interface{} {
+			var res struct {
+				App struct {
+					AppCredentials []struct {
+						ApiProductReferences interface{} `json:"apiProductReferences"`
+					} `json:"appCredentials"`
+				} `json:"app"`
+			}
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.App.AppCredentials).Should(HaveLen(1))
+			return res.App.AppCredentials[0].ApiProductReferences
+		}
+		pars := map[string][]string{
+			IdentifierOrganization: {"test-org"},
+			IdentifierAppId:        {"test-app"},
+		}
+
+		It("should return the status of each reference", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(refs(body)).Should(Equal([]interface{}{
+				map[string]interface{}{"apiProduct": "prod1", "status": dummyReferenceStatus},
+			}))
+		})
+
+		It("should return names only in legacy mode", func() {
+			apiMan.LegacyProductReferences = true
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(refs(body)).Should(Equal([]interface{}{"prod1"}))
+
+			var res AppSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.App.AppCredentials[0].ApiProductReferences[0].ApiProduct).Should(Equal("prod1"))
+		})
+	})
+
+	Context("Expand", func() {
+		BeforeEach(func() {
+			dbMan.apps = []common.App{
+				{Id: testId, Name: "apstest", Status: "APPROVED", DeveloperId: testId, ParentId: testId, Type: AppTypeDeveloper},
+			}
+			dbMan.developers = []common.Developer{{Id: testId, Email: "bar@google.com"}}
+			dbMan.companies = nil
+			dbMan.apiProducts = []common.ApiProduct{
+				{Id: testId, Name: "prod1", ApiResources: "{/**}", Scopes: "{}", Proxies: "{}", Environments: "{}"},
+			}
+			dbMan.apiProductIds = map[string][]string{testId: {testId}, "key1": {testId}}
+			dbMan.appCredentials = []common.AppCredential{
+				{Id: "key1", AppId: testId, Status: "APPROVED", Scopes: "{}"},
+			}
+		})
+
+		It("should inline the related entities of apps", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppId:        {testId},
+				ParameterExpand:        {"apiproducts,developer", "credentials"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			expanded := res.App.Expanded
+			Expect(expanded).ShouldNot(BeNil())
+			Expect(expanded.ApiProducts).Should(HaveLen(1))
+			Expect(expanded.ApiProducts[0].Name).Should(Equal("prod1"))
+			Expect(expanded.ApiProducts[0].Attributes).Should(Equal(attrs))
+			Expect(expanded.Developer.Email).Should(Equal("bar@google.com"))
+			Expect(expanded.Developer.Attributes).Should(Equal(attrs))
+			Expect(expanded.Company).Should(BeNil())
+			Expect(expanded.Credentials).Should(HaveLen(1))
+			Expect(expanded.Credentials[0].ConsumerKey).Should(Equal("key1"))
+			Expect(expanded.Credentials[0].AppName).Should(Equal("apstest"))
+		})
+
+		It("should inline the related entities of app credentials", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierConsumerKey:  {"key1"},
+				ParameterExpand:        {"apiProducts,developer"},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppCredentialSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			expanded := res.AppCredential.Expanded
+			Expect(expanded).ShouldNot(BeNil())
+			Expect(expanded.ApiProducts).Should(HaveLen(1))
+			Expect(expanded.ApiProducts[0].Name).Should(Equal("prod1"))
+			Expect(expanded.Developer.ID).Should(Equal(testId))
+			Expect(expanded.Credentials).Should(BeNil())
+		})
+
+		It("should not inline anything by default", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppId:        {testId},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.App.Expanded).Should(BeNil())
+		})
+
+		It("should reject unsupported expansions", func() {
+			code, _ := clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierConsumerKey:  {"key1"},
+				ParameterExpand:        {"credentials"},
+			})
+			Expect(code).Should(Equal(http.StatusBadRequest))
+			code, _ = clientGet(apiMan.AccessEntityPath+EndpointDeveloper, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierDeveloperId:  {testId},
+				ParameterExpand:        {"company"},
+			})
+			Expect(code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("Attributes", func() {
+		pars := func(extra map[string][]string) map[string][]string {
+			p := map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierDeveloperId:  {testId},
+			}
+			for k, v := range extra {
+				p[k] = v
+			}
+			return p
+		}
+
+		BeforeEach(func() {
+			dbMan.developers = []common.Developer{
+				{Id: testId, Email: "bar@google.com"},
+			}
+			dbMan.attrs[testId] = append(attrs, common.Attribute{Name: "limits", Value: `{"rate": 10}`})
+		})
+
+		It("should return the selected attributes", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointDeveloper, pars(map[string][]string{
+				ParameterAttributes: {"foo,limits", "unknown"},
+			}))
+			Expect(code).Should(Equal(http.StatusOK))
+			var res DeveloperSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.Developer.Attributes).Should(Equal([]common.Attribute{
+				{Name: "foo", Value: "bar"},
+				{Name: "limits", Value: `{"rate": 10}`},
+			}))
+		})
+
+		It("should return typed attributes as an object", func() {
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointDeveloper, pars(map[string][]string{
+				ParameterAttributesFormat: {common.AttributesFormatMap},
+				ParameterTypedAttributes:  {"true"},
+			}))
+			Expect(code).Should(Equal(http.StatusOK))
+			var res struct {
+				Developer struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"developer"`
+			}
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.Developer.Attributes).Should(Equal(map[string]interface{}{
+				"foo":    "bar",
+				"bar":    "foo",
+				"limits": map[string]interface{}{"rate": float64(10)},
+			}))
+		})
+
+		It("should reject an invalid attributes format", func() {
+			code, _ := clientGet(apiMan.AccessEntityPath+EndpointDeveloper, pars(map[string][]string{
+				ParameterAttributesFormat: {"xml"},
+			}))
+			Expect(code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("Redaction", func() {
+		pars := map[string][]string{
+			IdentifierOrganization: {"test-org"},
+			IdentifierConsumerKey:  {"test-key"},
+		}
+
+		BeforeEach(func() {
+			dbMan.appCredentials = []common.AppCredential{
+				{Id: testId, AppId: testId, ConsumerSecret: "secret1", Status: "APPROVED", Scopes: "{}"},
+			}
+			dbMan.apps = []common.App{
+				{Id: testId, Name: "apstest", Status: "APPROVED", DeveloperId: "dev", ParentId: "dev", Type: AppTypeDeveloper},
+			}
+			dbMan.developers = []common.Developer{
+				{Id: testId, Email: "bar@google.com", Password: "111"},
+			}
+		})
+
+		It("should apply the default rules", func() {
+			policy, err := CreateRedactionPolicy("")
+			Expect(err).Should(Succeed())
+			apiMan.Redaction = policy
+
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppCredentialSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.AppCredential.ConsumerSecret).Should(Equal(redactedMask))
+			Expect(res.AppCredential.ConsumerKeyStatus.AppCredential.ConsumerSecret).Should(Equal(redactedMask))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointDeveloper, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(string(body)).ShouldNot(ContainSubstring(`"password"`))
+		})
+
+		It("should apply rules per endpoint", func() {
+			policy, err := CreateRedactionPolicy("appcredentials:consumerSecret=encrypt, /apps:consumerSecret=omit, password=plaintext")
+			Expect(err).Should(Succeed())
+			apiMan.Redaction = policy
+			apiMan.CipherManager = &DummyCipherMan{}
+
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			var res AppCredentialSuccessResponse
+			Expect(json.Unmarshal(body, &res)).Should(Succeed())
+			Expect(res.AppCredential.ConsumerSecret).Should(Equal(dummyEncryptPrefix + "secret1"))
+			Expect(res.AppCredential.ConsumerKeyStatus.AppCredential.ConsumerSecret).Should(Equal(dummyEncryptPrefix + "secret1"))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointApp, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			Expect(string(body)).ShouldNot(ContainSubstring(`"consumerSecret"`))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointDeveloper, pars)
+			Expect(code).Should(Equal(http.StatusOK))
+			var devRes DeveloperSuccessResponse
+			Expect(json.Unmarshal(body, &devRes)).Should(Succeed())
+			Expect(devRes.Developer.Password).Should(Equal("111"))
+		})
+
+		It("should apply the rules of the requested endpoint to expanded developers", func() {
+			dbMan.developers = []common.Developer{
+				{Id: "dev", Email: "bar@google.com", Password: "111"},
+			}
+			policy, err := CreateRedactionPolicy("apps:password=plaintext")
+			Expect(err).Should(Succeed())
+			apiMan.Redaction = policy
+
+			code, body := clientGet(apiMan.AccessEntityPath+EndpointApp, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierAppId:        {testId},
+				ParameterExpand:        {ExpandDeveloper},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var appRes AppSuccessResponse
+			Expect(json.Unmarshal(body, &appRes)).Should(Succeed())
+			Expect(appRes.App.Expanded.Developer.Password).Should(Equal("111"))
+
+			code, body = clientGet(apiMan.AccessEntityPath+EndpointAppCredentials, map[string][]string{
+				IdentifierOrganization: {"test-org"},
+				IdentifierConsumerKey:  {testId},
+				ParameterExpand:        {ExpandDeveloper},
+			})
+			Expect(code).Should(Equal(http.StatusOK))
+			var credRes AppCredentialSuccessResponse
+			Expect(json.Unmarshal(body, &credRes)).Should(Succeed())
+			Expect(credRes.AppCredential.Expanded.Developer.Password).Should(BeEmpty())
+		})
+
+		It("should omit secrets which cannot be encrypted", func() {
+			policy := &RedactionPolicy{Rules: map[string]map[string]string{"": {FieldConsumerSecret: RedactEncrypt}}}
+			Expect(policy.redact(EndpointApp, FieldConsumerSecret, "secret1", "test-org", nil)).Should(BeEmpty())
+			Expect(policy.redact(EndpointApp, "unknownSecret", "secret1", "test-org", &DummyCipherMan{})).Should(BeEmpty())
+		})
+
+		It("should return the decrypted secrets of the DB", func() {
+			dir, err := ioutil.TempDir(testTempDirBase, "sqlite3")
+			Expect(err).Should(Succeed())
+			services.Config().Set("local_storage_path", dir)
+			realDbMan := &DbManager{
+				DbManager: common.DbManager{
+					Data:          services.Data(),
+					DbMux:         sync.RWMutex{},
+					CipherManager: &DummyCipherMan{},
+				},
+			}
+			realDbMan.SetDbVersion(dir)
+			setupTestDb(realDbMan.GetDb())
+			apiMan.DbMan = realDbMan
+
+			res, errRes := apiMan.getApp("apid-haoming", map[string]string{IdentifierAppId: "408ad853-3fa0-402f-90ee-103de98d71a5"}, false, expansion{ExpandCredentials: true})
+			Expect(errRes).Should(BeNil())
+			Expect(res.App.AppCredentials).Should(HaveLen(1))
+			Expect(res.App.AppCredentials[0].ConsumerSecret).Should(Equal("secret1"))
+			Expect(res.App.Expanded.Credentials[0].ConsumerSecret).Should(Equal("secret1"))
+		})
+
+		It("should reject invalid rules", func() {
+			for _, spec := range []string{"consumerSecret", "consumerSecret=hide", "foo:consumerSecret=omit", "apps:=omit"} {
+				_, err := CreateRedactionPolicy(spec)
+				Expect(err).ShouldNot(Succeed(), spec)
+			}
+		})
+	})
 })
 
 func setAttrs(dbMan *DummyDbMan, id string) []common.Attribute {
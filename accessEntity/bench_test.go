@@ -0,0 +1,262 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package accessEntity
+
+import (
+	"fmt"
+	"github.com/apid/apid-core/factory"
+	"github.com/apid/apidApiMetadata/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/*
+ * Benchmarks of the company developer and app paths on generated KMS data, run with
+ *   go test -run NONE -bench . ./accessEntity
+ * Each path is measured as implemented, and as the per entity queries it replaced, which are kept here as a baseline.
+ */
+
+const (
+	benchOrg      = "bench-org"
+	benchTenant   = "bench-tenant"
+	benchCompany  = "bench-company"
+	benchProducts = 10
+)
+
+// numbers of developers of the generated company, see generateBenchData
+var benchSizes = []int{10, 100, 1000}
+
+func BenchmarkCompanyDevelopers(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B, apiMan *ApiManager) {
+		ids := map[string]string{IdentifierCompanyName: benchCompany}
+		b.Run("batched", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, errRes := apiMan.getCompanyDeveloper(benchOrg, ids); errRes != nil {
+					b.Fatal(errRes.ResponseMessage)
+				}
+			}
+		})
+		b.Run("perEntity", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := companyDevelopersPerEntity(apiMan.DbMan, ids); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkApps(b *testing.B) {
+	forEachBenchSize(b, func(b *testing.B, apiMan *ApiManager) {
+		apps := benchApps(apiMan.DbMan, b)
+		b.Run("batched", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, errRes := apiMan.getAppsDetails(benchOrg, apps); errRes != nil {
+					b.Fatal(errRes.ResponseMessage)
+				}
+			}
+		})
+		b.Run("perEntity", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := appsPerEntity(apiMan.DbMan, apps); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+// benchApps returns all the apps of the org, developer and company ones
+func benchApps(dbMan DbManagerInterface, b *testing.B) (apps []common.App) {
+	after := ""
+	for {
+		page, err := dbMan.ListApps(benchOrg, "", "", after, maxListLimit)
+		if err != nil {
+			b.Fatal(err)
+		}
+		apps = append(apps, page...)
+		if len(page) < maxListLimit {
+			return apps
+		}
+		after = page[len(page)-1].Id
+	}
+}
+
+// companyDevelopersPerEntity queries the company developers as getCompanyDeveloper did before batching
+func companyDevelopersPerEntity(dbMan DbManagerInterface, ids map[string]string) error {
+	devs, err := dbMan.GetCompanyDevelopers(benchOrg, IdentifierCompanyName, ids[IdentifierCompanyName], "", "")
+	if err != nil {
+		return err
+	}
+	for _, dev := range devs {
+		if _, err = dbMan.GetComNames(dev.CompanyId, TypeCompany); err != nil {
+			return err
+		}
+		if _, err = dbMan.GetDevEmailByDevId(dev.DeveloperId, benchOrg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appsPerEntity queries the details of the apps as getApp did before batching
+func appsPerEntity(dbMan DbManagerInterface, apps []common.App) error {
+	for _, app := range apps {
+		if _, err := dbMan.GetKmsAttributes(app.TenantId, app.Id); err != nil {
+			return err
+		}
+		if _, err := dbMan.GetApiProductNames(app.Id, TypeApp); err != nil {
+			return err
+		}
+		if _, err := dbMan.GetStatus(app.ParentId, app.Type); err != nil {
+			return err
+		}
+		creds, err := dbMan.GetAppCredentials(benchOrg, IdentifierAppId, app.Id, "", "")
+		if err != nil {
+			return err
+		}
+		for _, cred := range creds {
+			if _, err = dbMan.GetApiProductNames(cred.Id, TypeConsumerKey); err != nil {
+				return err
+			}
+			if _, err = dbMan.GetKmsAttributes(cred.TenantId, cred.Id); err != nil {
+				return err
+			}
+		}
+		if app.Type == AppTypeCompany {
+			if _, err = dbMan.GetComNames(app.ParentId, TypeCompany); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forEachBenchSize runs the benchmark against a generated DB of each size
+func forEachBenchSize(b *testing.B, bench func(*testing.B, *ApiManager)) {
+	initBenchServices()
+	dir, err := ioutil.TempDir("", "access_entity_bench_")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	services.Config().Set("local_storage_path", dir)
+	for _, size := range benchSizes {
+		dbMan := &DbManager{
+			DbManager: common.DbManager{
+				Data:          services.Data(),
+				DbMux:         sync.RWMutex{},
+				CipherManager: &DummyCipherMan{},
+			},
+		}
+		dbMan.SetDbVersion(filepath.Join(dir, strconv.Itoa(size)))
+		if err := generateBenchData(dbMan, size); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("developers=%d", size), func(b *testing.B) {
+			bench(b, &ApiManager{DbMan: dbMan})
+		})
+	}
+}
+
+var benchServicesOnce sync.Once
+
+// initBenchServices sets up the services if the test suite, which normally does it, did not run
+func initBenchServices() {
+	benchServicesOnce.Do(func() {
+		if services == nil {
+			s := factory.DefaultServicesFactory()
+			SetApidServices(s, s.Log())
+			common.SetApidServices(s, s.Log())
+		}
+	})
+}
+
+/*
+ * generateBenchData creates the tables of data_test.sql, and an org whose company has the given number of developers.
+ * Each developer has a developer app and a company app, each app has two credentials mapped to three apiproducts,
+ * and every entity has three attributes.
+ */
+func generateBenchData(dbMan *DbManager, developers int) error {
+	schema, err := ioutil.ReadFile(fileDataTest)
+	if err != nil {
+		return err
+	}
+	db := dbMan.GetDb()
+	if _, err = db.Exec(string(schema)); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := func(query string, args ...interface{}) {
+		if err == nil {
+			_, err = tx.Exec(query, args...)
+		}
+	}
+	attributes := func(id, entityType string) {
+		for i := 0; i < 3; i++ {
+			exec(`INSERT INTO kms_attributes (tenant_id,entity_id,name,type,value) VALUES (?,?,?,?,?)`,
+				benchTenant, id, "attr"+strconv.Itoa(i), entityType, "value"+strconv.Itoa(i))
+		}
+	}
+	const ts = "2017-08-18 22:13:18.35+00:00"
+	exec(`INSERT INTO kms_organization (id,name,tenant_id) VALUES (?,?,?)`, benchOrg, benchOrg, benchTenant)
+	exec(`INSERT INTO kms_company VALUES (?,?,?,?,'ACTIVE',?,'bench',?,'bench',?)`,
+		benchCompany, benchTenant, benchCompany, benchCompany, ts, ts, benchTenant)
+	attributes(benchCompany, "COMPANY")
+	for i := 0; i < benchProducts; i++ {
+		id := fmt.Sprintf("prod-%03d", i)
+		exec(`INSERT INTO kms_api_product VALUES (?,?,?,?,'','{/**}','AUTO','{}','{}','{prod,test}','1000','MINUTE',1,?,'bench',?,'bench',?)`,
+			id, benchTenant, id, id, ts, ts, benchTenant)
+		attributes(id, "APIPRODUCT")
+	}
+	for i := 0; i < developers && err == nil; i++ {
+		devId := fmt.Sprintf("dev-%05d", i)
+		exec(`INSERT INTO kms_developer VALUES (?,?,?,'first','last','',?,'ACTIVE','','',?,'bench',?,'bench',?)`,
+			devId, benchTenant, devId, devId+"@bench.com", ts, ts, benchTenant)
+		exec(`INSERT INTO kms_company_developer VALUES (?,?,?,'{admin}',?,'bench',?,'bench',?)`,
+			benchTenant, benchCompany, devId, ts, ts, benchTenant)
+		attributes(devId, "DEVELOPER")
+		for _, parent := range []struct{ appType, parentId, comId, devId string }{
+			{AppTypeDeveloper, devId, "", devId},
+			{AppTypeCompany, benchCompany, benchCompany, ""},
+		} {
+			appId := fmt.Sprintf("app-%s-%05d", parent.appType, i)
+			exec(`INSERT INTO kms_app VALUES (?,?,?,?,'READ','https://bench.com','APPROVED','default',?,?,?,?,?,'bench',?,'bench',?)`,
+				appId, benchTenant, appId, appId, parent.comId, parent.devId, parent.parentId, parent.appType, ts, ts, benchTenant)
+			attributes(appId, "APP")
+			for c := 0; c < 2; c++ {
+				key := fmt.Sprintf("%s-key-%d", appId, c)
+				exec(`INSERT INTO kms_app_credential VALUES (?,?,'secret',?,'','APPROVED',?,'','','{}',?,'bench',?,'bench',?)`,
+					key, benchTenant, appId, ts, ts, ts, benchTenant)
+				attributes(key, "APP_CREDENTIAL")
+				for p := 0; p < 3; p++ {
+					exec(`INSERT INTO kms_app_credential_apiproduct_mapper VALUES (?,?,?,?,'APPROVED',?)`,
+						benchTenant, key, appId, fmt.Sprintf("prod-%03d", (i+c+p)%benchProducts), benchTenant)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -16,7 +16,6 @@ package accessEntity
 import (
 	"database/sql"
 	"fmt"
-	"github.com/apid/apid-core/util"
 	"github.com/apid/apidApiMetadata/common"
 	"strings"
 )
@@ -30,6 +29,18 @@ type DbManager struct {
 	common.DbManager
 }
 
+// WithPin returns a DbManager reading from the pinned DB only
+func (d *DbManager) WithPin(pin *common.DbPin) DbManagerInterface {
+	return &DbManager{
+		DbManager: common.DbManager{
+			Data:            d.Data,
+			CipherManager:   d.CipherManager,
+			ResourceMatcher: d.ResourceMatcher,
+			Pin:             pin,
+		},
+	}
+}
+
 func (d *DbManager) GetApiProductNames(id string, idType string) ([]string, error) {
 	var query string
 	switch idType {
@@ -230,11 +241,17 @@ func (d *DbManager) GetApiProducts(org, priKey, priVal, secKey, secVal string) (
 	}
 
 	if secKey == IdentifierApiResource {
-		apiProducts = filterApiProductsByResource(apiProducts, secVal)
+		apiProducts = d.filterApiProductsByResource(apiProducts, secVal)
 	}
 	return
 }
 
+// MatchApiResource returns the first resource of the apiproduct matching the path, see common.ResourceMatcher.
+func (d *DbManager) MatchApiResource(prod *common.ApiProduct, resource string) (string, bool) {
+	resources := common.JsonToStringArray(prod.ApiResources)
+	return d.ResourceMatcher.Match(d.GetDbVersion(), prod.Id, resources, resource)
+}
+
 func (d *DbManager) GetApps(org, priKey, priVal, secKey, secVal string) (apps []common.App, err error) {
 	switch priKey {
 	case IdentifierAppId:
@@ -313,6 +330,93 @@ func (d *DbManager) GetDevelopers(org, priKey, priVal, secKey, secVal string) (d
 	return
 }
 
+func (d *DbManager) ListApiProducts(org, filterKey, filterVal, after string, limit int) (apiProducts []common.ApiProduct, err error) {
+	if filterKey != "" {
+		return nil, fmt.Errorf("unsupported filter %v", filterKey)
+	}
+	err = d.queryPage(&apiProducts, "kms_api_product", "ap", org, "", nil, after, limit)
+	return
+}
+
+func (d *DbManager) ListApps(org, filterKey, filterVal, after string, limit int) (apps []common.App, err error) {
+	var cond string
+	switch filterKey {
+	case "":
+	case IdentifierDeveloperId:
+		cond = " AND a.developer_id = ?"
+	case IdentifierDeveloperEmail:
+		cond = " AND a.developer_id IN (" +
+			selectDeveloperByEmail(
+				"?",
+				"id",
+			) + " AND dev.tenant_id IN " + sql_select_tenant_org + ")"
+	case IdentifierCompanyName:
+		cond = " AND a.company_id IN (" +
+			selectCompanyByName(
+				"?",
+				"id",
+			) + " AND com.tenant_id IN " + sql_select_tenant_org + ")"
+	default:
+		return nil, fmt.Errorf("unsupported filter %v", filterKey)
+	}
+	err = d.queryPage(&apps, "kms_app", "a", org, cond, filterArgs(filterKey, filterVal, org), after, limit)
+	return
+}
+
+func (d *DbManager) ListCompanies(org, filterKey, filterVal, after string, limit int) (companies []common.Company, err error) {
+	if filterKey != "" {
+		return nil, fmt.Errorf("unsupported filter %v", filterKey)
+	}
+	err = d.queryPage(&companies, "kms_company", "com", org, "", nil, after, limit)
+	return
+}
+
+func (d *DbManager) ListDevelopers(org, filterKey, filterVal, after string, limit int) (developers []common.Developer, err error) {
+	var cond string
+	switch filterKey {
+	case "":
+	case IdentifierCompanyName:
+		cond = " AND dev.id IN (" +
+			selectCompanyDeveloperByComId(
+				selectCompanyByName(
+					"?",
+					"id",
+				)+" AND com.tenant_id IN "+sql_select_tenant_org,
+				"developer_id",
+			) + ")"
+	default:
+		return nil, fmt.Errorf("unsupported filter %v", filterKey)
+	}
+	err = d.queryPage(&developers, "kms_developer", "dev", org, cond, filterArgs(filterKey, filterVal, org), after, limit)
+	return
+}
+
+// filterArgs returns the arguments of the condition of a list filter
+func filterArgs(filterKey, filterVal, org string) []interface{} {
+	switch filterKey {
+	case "":
+		return nil
+	case IdentifierDeveloperId:
+		return []interface{}{filterVal}
+	}
+	// filters by name are looked up in the org
+	return []interface{}{filterVal, org}
+}
+
+/*
+ * queryPage selects up to limit entities of the org from the table, with ids greater than after and
+ * matching the condition, ordered by id so that pages are stable.
+ */
+func (d *DbManager) queryPage(dest interface{}, table, alias, org, cond string, condArgs []interface{}, after string, limit int) error {
+	query := "SELECT * FROM " + table + " AS " + alias +
+		" WHERE " + alias + ".tenant_id IN " + sql_select_tenant_org +
+		cond +
+		" AND " + alias + ".id > ? ORDER BY " + alias + ".id LIMIT ?"
+	args := append([]interface{}{org}, condArgs...)
+	args = append(args, after, limit)
+	return d.GetDb().QueryStructs(dest, query, args...)
+}
+
 func (d *DbManager) getApiProductsByName(apiProdName string, org string) (apiProducts []common.ApiProduct, err error) {
 	err = d.GetDb().QueryStructs(&apiProducts,
 		sql_select_api_product+
@@ -611,6 +715,262 @@ func (d *DbManager) getDeveloperById(id, org string) (developers []common.Develo
 	return
 }
 
+// GetApiProductIds returns the ids of the apiproducts of each app or consumer key, fetched in batches
+func (d *DbManager) GetApiProductIds(ids []string, idType string) (map[string][]string, error) {
+	selectMapper, idCol, err := mapperSelect(idType)
+	if err != nil {
+		return nil, err
+	}
+	prodIds := make(map[string][]string)
+	err = d.queryIdValues(ids, func(placeholders string) string {
+		return selectMapper(placeholders, idCol, "apiprdt_id")
+	}, func(id, prodId string) {
+		// the apiproducts of an app are mapped once for each of its credentials
+		if !containsString(prodIds[id], prodId) {
+			prodIds[id] = append(prodIds[id], prodId)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prodIds, nil
+}
+
+// GetApiProductNamesByIds returns the apiproduct names of each app or consumer key, as GetApiProductNames does for one
+func (d *DbManager) GetApiProductNamesByIds(ids []string, idType string) (map[string][]string, error) {
+	_, idCol, err := mapperSelect(idType)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string][]string)
+	err = d.queryIdValues(ids, func(placeholders string) string {
+		return "SELECT DISTINCT acm." + idCol + ", ap.name FROM kms_app_credential_apiproduct_mapper AS acm" +
+			" INNER JOIN kms_api_product AS ap ON ap.id = acm.apiprdt_id WHERE acm." + idCol + " IN (" + placeholders + ")"
+	}, func(id, name string) {
+		names[id] = append(names[id], name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetApiProductReferences returns the apiproducts the consumer keys are mapped to, with the status of each mapping
+func (d *DbManager) GetApiProductReferences(consumerKeys []string) (refs []common.ApiProductReference, err error) {
+	err = common.QueryChunks(consumerKeys, func(args []interface{}, placeholders string) error {
+		var chunk []common.ApiProductReference
+		query := "SELECT acm.appcred_id, ap.name, acm.status FROM kms_app_credential_apiproduct_mapper AS acm" +
+			" INNER JOIN kms_api_product AS ap ON ap.id = acm.apiprdt_id WHERE acm.appcred_id IN (" + placeholders + ")"
+		if err := d.GetDb().QueryStructs(&chunk, query, args...); err != nil {
+			return err
+		}
+		refs = append(refs, chunk...)
+		return nil
+	})
+	return
+}
+
+// GetAppCredentialsByAppIds returns the credentials of the apps, with their secrets decrypted
+func (d *DbManager) GetAppCredentialsByAppIds(org string, appIds []string) (appCredentials []common.AppCredential, err error) {
+	err = common.QueryChunks(appIds, func(args []interface{}, placeholders string) error {
+		var creds []common.AppCredential
+		query := selectAppCredentialByConsumerKey(
+			selectAppCredentialMapperByAppId(
+				placeholders,
+				"appcred_id",
+			),
+			"*",
+		) + " AND ac.tenant_id IN " + sql_select_tenant_org
+		if err := d.GetDb().QueryStructs(&creds, query, append(args, org)...); err != nil {
+			return err
+		}
+		appCredentials = append(appCredentials, creds...)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	var plaintext string
+	for i := range appCredentials {
+		if plaintext, err = d.CipherManager.TryDecryptBase64(appCredentials[i].ConsumerSecret, org); err != nil {
+			return
+		}
+		appCredentials[i].ConsumerSecret = plaintext
+	}
+	return
+}
+
+// GetComNamesByComIds returns the name of each company
+func (d *DbManager) GetComNamesByComIds(comIds []string) (map[string]string, error) {
+	names := make(map[string]string)
+	err := d.queryIdValues(comIds, func(placeholders string) string {
+		return selectCompanyByComId(placeholders, "id", "name")
+	}, func(id, name string) {
+		names[id] = name
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetDevEmailsByDevIds returns the email of each developer
+func (d *DbManager) GetDevEmailsByDevIds(devIds []string) (map[string]string, error) {
+	emails := make(map[string]string)
+	err := d.queryIdValues(devIds, func(placeholders string) string {
+		return selectDeveloperById(placeholders, "id", "email")
+	}, func(id, email string) {
+		emails[id] = email
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// GetComNamesByDevIds returns the company names of each developer, as GetComNames does for one
+func (d *DbManager) GetComNamesByDevIds(devIds []string) (map[string][]string, error) {
+	names := make(map[string][]string)
+	err := d.queryIdValues(devIds, func(placeholders string) string {
+		return "SELECT cd.developer_id, com.name FROM kms_company_developer AS cd" +
+			" INNER JOIN kms_company AS com ON com.id = cd.company_id WHERE cd.developer_id IN (" + placeholders + ")"
+	}, func(id, name string) {
+		names[id] = append(names[id], name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetAppNamesByIds returns the app names of each developer or company, as GetAppNames does for one
+func (d *DbManager) GetAppNamesByIds(ids []string, t string) (map[string][]string, error) {
+	var selectByIds func(string, ...string) string
+	var idCol string
+	switch t {
+	case TypeDeveloper:
+		selectByIds, idCol = selectAppByDevId, "developer_id"
+	case TypeCompany:
+		selectByIds, idCol = selectAppByComId, "company_id"
+	default:
+		return nil, fmt.Errorf("app type not supported")
+	}
+	names := make(map[string][]string)
+	err := d.queryIdValues(ids, func(placeholders string) string {
+		return selectByIds(placeholders, idCol, "name")
+	}, func(id, name string) {
+		names[id] = append(names[id], name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetStatuses returns the status of each developer or company, as GetStatus does for one
+func (d *DbManager) GetStatuses(ids []string, t string) (map[string]string, error) {
+	var selectById func(string, ...string) string
+	switch t {
+	case AppTypeDeveloper:
+		selectById = selectDeveloperById
+	case AppTypeCompany:
+		selectById = selectCompanyByComId
+	default:
+		return nil, fmt.Errorf("unsupported type")
+	}
+	statuses := make(map[string]string)
+	err := d.queryIdValues(ids, func(placeholders string) string {
+		return selectById(placeholders, "id", "status")
+	}, func(id, status string) {
+		statuses[id] = status
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// queryIdValues runs the query, which selects an id and a value, for each chunk of the ids, calling add for each row
+func (d *DbManager) queryIdValues(ids []string, query func(placeholders string) string, add func(id, val string)) error {
+	return common.QueryChunks(ids, func(args []interface{}, placeholders string) error {
+		rows, err := d.GetDb().Query(query(placeholders), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, val sql.NullString
+			if err := rows.Scan(&id, &val); err != nil {
+				return err
+			}
+			if id.Valid && val.Valid {
+				add(id.String, val.String)
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// mapperSelect returns the query selecting kms_app_credential_apiproduct_mapper rows by ids of the type, and their column
+func mapperSelect(idType string) (func(string, ...string) string, string, error) {
+	switch idType {
+	case TypeApp:
+		return selectAppCredentialMapperByAppId, "app_id", nil
+	case TypeConsumerKey:
+		return selectAppCredentialMapperByConsumerKey, "appcred_id", nil
+	}
+	return nil, "", fmt.Errorf("unsupported idType")
+}
+
+func (d *DbManager) GetApiProductsByIds(org string, ids []string) (apiProducts []common.ApiProduct, err error) {
+	err = common.QueryChunks(ids, func(args []interface{}, placeholders string) error {
+		var prods []common.ApiProduct
+		query := selectApiProductsById(placeholders, "*") + " AND ap.tenant_id IN " + sql_select_tenant_org
+		if err := d.GetDb().QueryStructs(&prods, query, append(args, org)...); err != nil {
+			return err
+		}
+		apiProducts = append(apiProducts, prods...)
+		return nil
+	})
+	return
+}
+
+func (d *DbManager) GetCompaniesByIds(org string, ids []string) (companies []common.Company, err error) {
+	err = common.QueryChunks(ids, func(args []interface{}, placeholders string) error {
+		var coms []common.Company
+		query := selectCompanyByComId(placeholders, "*") + " AND com.tenant_id IN " + sql_select_tenant_org
+		if err := d.GetDb().QueryStructs(&coms, query, append(args, org)...); err != nil {
+			return err
+		}
+		companies = append(companies, coms...)
+		return nil
+	})
+	return
+}
+
+func (d *DbManager) GetDevelopersByIds(org string, ids []string) (developers []common.Developer, err error) {
+	err = common.QueryChunks(ids, func(args []interface{}, placeholders string) error {
+		var devs []common.Developer
+		query := selectDeveloperById(placeholders, "*") + " AND dev.tenant_id IN " + sql_select_tenant_org
+		if err := d.GetDb().QueryStructs(&devs, query, append(args, org)...); err != nil {
+			return err
+		}
+		developers = append(developers, devs...)
+		return nil
+	})
+	return
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 func selectApiProductsById(idQuery string, colNames ...string) string {
 	query := "SELECT " +
 		strings.Join(colNames, ",") +
@@ -754,12 +1114,13 @@ func selectAppCredentialByConsumerKey(consumerQuery string, colNames ...string)
 	return query
 }
 
-func filterApiProductsByResource(apiProducts []common.ApiProduct, resource string) []common.ApiProduct {
+// keeps the apiproducts with a resource matching the given path
+func (d *DbManager) filterApiProductsByResource(apiProducts []common.ApiProduct, resource string) []common.ApiProduct {
 	//log.Debugf("Before filter: %v", apiProducts)
 	var prods []common.ApiProduct
-	for _, prod := range apiProducts {
-		resources := common.JsonToStringArray(prod.ApiResources)
-		if util.Contains(resources, resource) {
+	for i := range apiProducts {
+		prod := apiProducts[i]
+		if _, ok := d.MatchApiResource(&prod, resource); ok {
 			prods = append(prods, prod)
 		}
 	}
@@ -173,6 +173,38 @@ var _ = Describe("DataTest", func() {
 				}
 			})
 
+			It("should filter apiProducts by apiresource path", func() {
+				testData := [][]string{
+					{IdentifierAppId, "408ad853-3fa0-402f-90ee-103de98d71a5", IdentifierApiResource, "/v1/orders/123", "apid-haoming"},
+					{IdentifierConsumerKey, "abcd", IdentifierApiResource, "/", "apid-haoming"},
+					{IdentifierAppName, "testappahhis", IdentifierApiResource, "/res1", "apid-haoming"},
+					{IdentifierAppName, "testappahhis", IdentifierApiResource, "/res1/123", "apid-haoming"},
+					{IdentifierAppName, "testappahhis", IdentifierApiResource, "/res", "apid-haoming"},
+				}
+				results := [][]string{
+					{"b7e0970c-4677-4b05-8105-5ea59fdcf4e7", "/**"},
+					{"b7e0970c-4677-4b05-8105-5ea59fdcf4e7", "/**"},
+					{"fea8a6d5-8d34-477f-ac82-c397eaec06af", "/res1"},
+					nil,
+					nil,
+				}
+
+				for i, data := range testData {
+					priKey, priVal, secKey, secVal, org := data[0], data[1], data[2], data[3], data[4]
+					prods, err := dbMan.GetApiProducts(org, priKey, priVal, secKey, secVal)
+					Expect(err).Should(Succeed())
+					if results[i] == nil {
+						Expect(prods).Should(BeZero())
+						continue
+					}
+					Expect(prods).Should(HaveLen(1))
+					Expect(prods[0].Id).Should(Equal(results[i][0]))
+					matched, ok := dbMan.MatchApiResource(&prods[0], secVal)
+					Expect(ok).Should(BeTrue())
+					Expect(matched).Should(Equal(results[i][1]))
+				}
+			})
+
 			It("should get apps", func() {
 				testData := [][]string{
 					//positive tests
@@ -497,6 +529,192 @@ var _ = Describe("DataTest", func() {
 
 		})
 
+		Describe("List structs", func() {
+			appIds := func(apps []common.App) (ids []string) {
+				for _, app := range apps {
+					ids = append(ids, app.Id)
+				}
+				return
+			}
+
+			It("should list apps by page", func() {
+				apps, err := dbMan.ListApps("apid-haoming", "", "", "", 2)
+				Expect(err).Should(Succeed())
+				Expect(appIds(apps)).Should(Equal([]string{
+					"35608afe-2715-4064-bb4d-3cbb4e82c474",
+					"408ad853-3fa0-402f-90ee-103de98d71a5",
+				}))
+				apps, err = dbMan.ListApps("apid-haoming", "", "", apps[1].Id, 2)
+				Expect(err).Should(Succeed())
+				Expect(appIds(apps)).Should(Equal([]string{"ae053aee-f12d-4591-84ef-2e6ae0d4205d"}))
+
+				apps, err = dbMan.ListApps("non-existent", "", "", "", 2)
+				Expect(err).Should(Succeed())
+				Expect(apps).Should(BeEmpty())
+			})
+
+			It("should list apps by filter", func() {
+				testData := [][]string{
+					{IdentifierDeveloperId, "e41f04e8-9d3f-470a-8bfd-c7939945896c", "408ad853-3fa0-402f-90ee-103de98d71a5"},
+					{IdentifierDeveloperEmail, "fooo@google.com", "ae053aee-f12d-4591-84ef-2e6ae0d4205d"},
+					{IdentifierCompanyName, "testcompanyhflxv", "35608afe-2715-4064-bb4d-3cbb4e82c474"},
+					{IdentifierDeveloperEmail, "non-existent", ""},
+					{IdentifierCompanyName, sqlInjectionStmt, ""},
+				}
+				for _, data := range testData {
+					apps, err := dbMan.ListApps("apid-haoming", data[0], data[1], "", 10)
+					Expect(err).Should(Succeed())
+					if data[2] == "" {
+						Expect(apps).Should(BeEmpty())
+					} else {
+						Expect(appIds(apps)).Should(Equal([]string{data[2]}))
+					}
+				}
+				_, err := dbMan.ListApps("apid-haoming", IdentifierAppName, "apstest", "", 10)
+				Expect(err).ShouldNot(Succeed())
+			})
+
+			It("should list developers, companies and apiProducts", func() {
+				devs, err := dbMan.ListDevelopers("apid-haoming", "", "", "", 10)
+				Expect(err).Should(Succeed())
+				Expect(devs).Should(HaveLen(3))
+				Expect(devs[0].Id < devs[1].Id && devs[1].Id < devs[2].Id).Should(BeTrue())
+
+				devs, err = dbMan.ListDevelopers("apid-haoming", IdentifierCompanyName, "testcompanyhflxv", "", 10)
+				Expect(err).Should(Succeed())
+				Expect(devs).Should(HaveLen(1))
+				Expect(devs[0].Id).Should(Equal("590f33bf-f05c-48c1-bb93-183759bd9ee1"))
+
+				coms, err := dbMan.ListCompanies("apid-haoming", "", "", "", 10)
+				Expect(err).Should(Succeed())
+				Expect(coms).Should(HaveLen(2))
+
+				prods, err := dbMan.ListApiProducts("apid-haoming", "", "", "", 4)
+				Expect(err).Should(Succeed())
+				Expect(prods).Should(HaveLen(4))
+				prods, err = dbMan.ListApiProducts("apid-haoming", "", "", prods[3].Id, 4)
+				Expect(err).Should(Succeed())
+				Expect(prods).Should(HaveLen(2))
+			})
+		})
+
+		Describe("Batch structs", func() {
+			It("should get apiProduct ids of apps and consumer keys", func() {
+				prodIds, err := dbMan.GetApiProductIds([]string{
+					"408ad853-3fa0-402f-90ee-103de98d71a5",
+					"non-existent",
+				}, TypeApp)
+				Expect(err).Should(Succeed())
+				Expect(prodIds).Should(Equal(map[string][]string{
+					"408ad853-3fa0-402f-90ee-103de98d71a5": {"b7e0970c-4677-4b05-8105-5ea59fdcf4e7"},
+				}))
+
+				prodIds, err = dbMan.GetApiProductIds([]string{"abcd"}, TypeConsumerKey)
+				Expect(err).Should(Succeed())
+				Expect(prodIds["abcd"]).Should(Equal([]string{"b7e0970c-4677-4b05-8105-5ea59fdcf4e7"}))
+
+				_, err = dbMan.GetApiProductIds([]string{"abcd"}, TypeCompany)
+				Expect(err).ShouldNot(Succeed())
+			})
+
+			It("should get apiProducts, developers and companies by ids", func() {
+				prods, err := dbMan.GetApiProductsByIds("apid-haoming", []string{"b7e0970c-4677-4b05-8105-5ea59fdcf4e7", sqlInjectionStmt})
+				Expect(err).Should(Succeed())
+				Expect(prods).Should(HaveLen(1))
+				Expect(prods[0].Name).Should(Equal("apstest"))
+
+				devs, err := dbMan.GetDevelopersByIds("apid-haoming", []string{"e41f04e8-9d3f-470a-8bfd-c7939945896c"})
+				Expect(err).Should(Succeed())
+				Expect(devs).Should(HaveLen(1))
+				Expect(devs[0].Email).Should(Equal("bar@google.com"))
+
+				coms, err := dbMan.GetCompaniesByIds("apid-haoming", []string{"a94f75e2-69b0-44af-8776-155df7c7d22e"})
+				Expect(err).Should(Succeed())
+				Expect(coms).Should(HaveLen(1))
+				Expect(coms[0].Name).Should(Equal("testcompanyhflxv"))
+
+				// entities of other orgs are not returned
+				devs, err = dbMan.GetDevelopersByIds("non-existent", []string{"e41f04e8-9d3f-470a-8bfd-c7939945896c"})
+				Expect(err).Should(Succeed())
+				Expect(devs).Should(BeEmpty())
+
+				coms, err = dbMan.GetCompaniesByIds("apid-haoming", nil)
+				Expect(err).Should(Succeed())
+				Expect(coms).Should(BeEmpty())
+			})
+		})
+
+		Describe("Batch utils", func() {
+			It("should get apiProduct names of apps and consumer keys", func() {
+				names, err := dbMan.GetApiProductNamesByIds([]string{"408ad853-3fa0-402f-90ee-103de98d71a5", "non-existent"}, TypeApp)
+				Expect(err).Should(Succeed())
+				Expect(names).Should(Equal(map[string][]string{"408ad853-3fa0-402f-90ee-103de98d71a5": {"apstest"}}))
+
+				names, err = dbMan.GetApiProductNamesByIds([]string{"abcd", sqlInjectionStmt}, TypeConsumerKey)
+				Expect(err).Should(Succeed())
+				Expect(names).Should(Equal(map[string][]string{"abcd": {"apstest"}}))
+
+				_, err = dbMan.GetApiProductNamesByIds([]string{"abcd"}, TypeDeveloper)
+				Expect(err).ShouldNot(Succeed())
+			})
+
+			It("should get apiProduct references of consumer keys", func() {
+				refs, err := dbMan.GetApiProductReferences([]string{"abcd", "non-existent", sqlInjectionStmt})
+				Expect(err).Should(Succeed())
+				Expect(refs).Should(Equal([]common.ApiProductReference{
+					{ConsumerKey: "abcd", Name: "apstest", Status: "APPROVED"},
+				}))
+			})
+
+			It("should get credentials of apps", func() {
+				creds, err := dbMan.GetAppCredentialsByAppIds("apid-haoming", []string{
+					"408ad853-3fa0-402f-90ee-103de98d71a5",
+					"ae053aee-f12d-4591-84ef-2e6ae0d4205d",
+				})
+				Expect(err).Should(Succeed())
+				Expect(creds).Should(HaveLen(2))
+				keys := []string{creds[0].Id, creds[1].Id}
+				Expect(keys).Should(ConsistOf("abcd", "dcba"))
+				secrets := []string{creds[0].ConsumerSecret, creds[1].ConsumerSecret}
+				Expect(secrets).Should(ConsistOf("secret1", "secret2"))
+
+				creds, err = dbMan.GetAppCredentialsByAppIds("non-existent", []string{"408ad853-3fa0-402f-90ee-103de98d71a5"})
+				Expect(err).Should(Succeed())
+				Expect(creds).Should(BeEmpty())
+			})
+
+			It("should get company names, developer emails and statuses", func() {
+				Expect(dbMan.GetComNamesByComIds([]string{"a94f75e2-69b0-44af-8776-155df7c7d22e", "non-existent"})).Should(Equal(map[string]string{
+					"a94f75e2-69b0-44af-8776-155df7c7d22e": "testcompanyhflxv",
+				}))
+				Expect(dbMan.GetDevEmailsByDevIds([]string{"e41f04e8-9d3f-470a-8bfd-c7939945896c", sqlInjectionStmt})).Should(Equal(map[string]string{
+					"e41f04e8-9d3f-470a-8bfd-c7939945896c": "bar@google.com",
+				}))
+				Expect(dbMan.GetStatuses([]string{"e41f04e8-9d3f-470a-8bfd-c7939945896c"}, AppTypeDeveloper)).Should(Equal(map[string]string{
+					"e41f04e8-9d3f-470a-8bfd-c7939945896c": "ACTIVE",
+				}))
+				Expect(dbMan.GetStatuses([]string{"a94f75e2-69b0-44af-8776-155df7c7d22e"}, AppTypeCompany)).Should(Equal(map[string]string{
+					"a94f75e2-69b0-44af-8776-155df7c7d22e": "ACTIVE",
+				}))
+				_, err := dbMan.GetStatuses([]string{"abcd"}, TypeConsumerKey)
+				Expect(err).ShouldNot(Succeed())
+			})
+
+			It("should get company names of developers and app names of developers and companies", func() {
+				Expect(dbMan.GetComNamesByDevIds([]string{"590f33bf-f05c-48c1-bb93-183759bd9ee1", sqlInjectionStmt})).Should(Equal(map[string][]string{
+					"590f33bf-f05c-48c1-bb93-183759bd9ee1": {"testcompanyhflxv"},
+				}))
+				Expect(dbMan.GetAppNamesByIds([]string{"e41f04e8-9d3f-470a-8bfd-c7939945896c", "non-existent"}, TypeDeveloper)).Should(Equal(map[string][]string{
+					"e41f04e8-9d3f-470a-8bfd-c7939945896c": {"apstest"},
+				}))
+				Expect(dbMan.GetAppNamesByIds([]string{"a94f75e2-69b0-44af-8776-155df7c7d22e"}, TypeCompany)).Should(Equal(map[string][]string{
+					"a94f75e2-69b0-44af-8776-155df7c7d22e": {"testappahhis"},
+				}))
+				_, err := dbMan.GetAppNamesByIds([]string{"abcd"}, TypeConsumerKey)
+				Expect(err).ShouldNot(Succeed())
+			})
+		})
+
 		Describe("utils", func() {
 			It("GetApiProductNamesByConsumerKey", func() {
 				data := "abcd"
@@ -0,0 +1,288 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accessEntity
+
+import (
+	"fmt"
+	"github.com/apid/apidApiMetadata/common"
+	"net/url"
+	"strings"
+)
+
+// query parameter, comma separated related entities to inline in the response, see ExpandTree
+const ParameterExpand = "expand"
+
+// related entities which may be expanded
+const (
+	// the apiproducts of apps, or of app credentials
+	ExpandApiProducts = "apiProducts"
+	// the developer of apps, or of the app of app credentials
+	ExpandDeveloper = "developer"
+	// the company of apps, or of the app of app credentials
+	ExpandCompany = "company"
+	// the app credentials of apps, as returned by the appcredentials endpoint
+	ExpandCredentials = "credentials"
+)
+
+// ExpandTree holds, by endpoint, the related entities its responses may inline
+var ExpandTree = map[string][]string{
+	EndpointApp:            {ExpandApiProducts, ExpandDeveloper, ExpandCompany, ExpandCredentials},
+	EndpointAppCredentials: {ExpandApiProducts, ExpandDeveloper, ExpandCompany},
+}
+
+// expansion is the set of related entities to inline
+type expansion map[string]bool
+
+func parseExpansion(endpoint string, pars url.Values) (expansion, error) {
+	expand := make(expansion)
+	for _, v := range pars[ParameterExpand] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			supported := ""
+			for _, e := range ExpandTree[endpoint] {
+				if strings.EqualFold(e, name) {
+					supported = e
+				}
+			}
+			if supported == "" {
+				return nil, fmt.Errorf("%s cannot be expanded for %s", name, endpoint)
+			}
+			expand[supported] = true
+		}
+	}
+	return expand, nil
+}
+
+// expandApps inlines the entities related to the apps, each kind of entity being fetched in batches
+func (a *ApiManager) expandApps(org string, apps []common.App, details []*AppDetails, expand expansion) *common.ErrorResponse {
+	if len(expand) == 0 {
+		return nil
+	}
+	appIds := make([]string, len(apps))
+	for i := range apps {
+		appIds[i] = apps[i].Id
+		details[i].Expanded = &ExpandedDetails{}
+	}
+	if expand[ExpandApiProducts] {
+		prods, errRes := a.getRelatedApiProducts(org, appIds, TypeApp)
+		if errRes != nil {
+			return errRes
+		}
+		for i := range apps {
+			details[i].Expanded.ApiProducts = prods[apps[i].Id]
+		}
+	}
+	if expand[ExpandDeveloper] || expand[ExpandCompany] {
+		parents := make([]*common.App, len(apps))
+		for i := range apps {
+			parents[i] = &apps[i]
+		}
+		expanded := make([]*ExpandedDetails, len(apps))
+		for i := range details {
+			expanded[i] = details[i].Expanded
+		}
+		if errRes := a.expandParents(EndpointApp, org, parents, expanded, expand); errRes != nil {
+			return errRes
+		}
+	}
+	if expand[ExpandCredentials] {
+		for i := range apps {
+			details[i].Expanded.Credentials = appCredentialDetails(&apps[i], details[i])
+		}
+	}
+	return nil
+}
+
+// expandAppCredentials inlines the entities related to the app credentials, apps being the app of each credential
+func (a *ApiManager) expandAppCredentials(org string, apps []*common.App, details []*AppCredentialDetails, expand expansion) *common.ErrorResponse {
+	if len(expand) == 0 {
+		return nil
+	}
+	keys := make([]string, len(details))
+	expanded := make([]*ExpandedDetails, len(details))
+	for i := range details {
+		keys[i] = details[i].ConsumerKey
+		details[i].Expanded = &ExpandedDetails{}
+		expanded[i] = details[i].Expanded
+	}
+	if expand[ExpandApiProducts] {
+		prods, errRes := a.getRelatedApiProducts(org, keys, TypeConsumerKey)
+		if errRes != nil {
+			return errRes
+		}
+		for i := range details {
+			details[i].Expanded.ApiProducts = prods[keys[i]]
+		}
+	}
+	return a.expandParents(EndpointAppCredentials, org, apps, expanded, expand)
+}
+
+// expandParents inlines the developer or the company of each app, redacted for the requested endpoint
+func (a *ApiManager) expandParents(endpoint, org string, apps []*common.App, expanded []*ExpandedDetails, expand expansion) *common.ErrorResponse {
+	if expand[ExpandDeveloper] {
+		var ids []string
+		for _, app := range apps {
+			if app.DeveloperId != "" {
+				ids = append(ids, app.DeveloperId)
+			}
+		}
+		devs, errRes := a.getDevelopersByIds(endpoint, org, ids)
+		if errRes != nil {
+			return errRes
+		}
+		for i, app := range apps {
+			expanded[i].Developer = devs[app.DeveloperId]
+		}
+	}
+	if expand[ExpandCompany] {
+		var ids []string
+		for _, app := range apps {
+			if app.CompanyId != "" {
+				ids = append(ids, app.CompanyId)
+			}
+		}
+		coms, errRes := a.getCompaniesByIds(org, ids)
+		if errRes != nil {
+			return errRes
+		}
+		for i, app := range apps {
+			expanded[i].Company = coms[app.CompanyId]
+		}
+	}
+	return nil
+}
+
+// getRelatedApiProducts returns the apiproducts of each app or consumer key
+func (a *ApiManager) getRelatedApiProducts(org string, ids []string, idType string) (map[string][]*ApiProductDetails, *common.ErrorResponse) {
+	prodIds, err := a.DbMan.GetApiProductIds(ids, idType)
+	if err != nil {
+		log.Errorf("getRelatedApiProducts: %v", err)
+		return nil, newDbError(err)
+	}
+	var allIds []string
+	for _, id := range ids {
+		allIds = append(allIds, prodIds[id]...)
+	}
+	prods, err := a.DbMan.GetApiProductsByIds(org, uniqueStrings(allIds))
+	if err != nil {
+		log.Errorf("getRelatedApiProducts: %v", err)
+		return nil, newDbError(err)
+	}
+	details, errRes := a.getApiProductsDetails(prods)
+	if errRes != nil {
+		return nil, errRes
+	}
+	byId := make(map[string]*ApiProductDetails, len(details))
+	for _, d := range details {
+		byId[d.ID] = d
+	}
+	related := make(map[string][]*ApiProductDetails)
+	for _, id := range ids {
+		for _, prodId := range prodIds[id] {
+			if details := byId[prodId]; details != nil {
+				related[id] = append(related[id], details)
+			}
+		}
+	}
+	return related, nil
+}
+
+func (a *ApiManager) getDevelopersByIds(endpoint, org string, ids []string) (map[string]*DeveloperDetails, *common.ErrorResponse) {
+	devs, err := a.DbMan.GetDevelopersByIds(org, uniqueStrings(ids))
+	if err != nil {
+		log.Errorf("getDevelopersByIds: %v", err)
+		return nil, newDbError(err)
+	}
+	details, errRes := a.getDevelopersDetails(endpoint, org, devs)
+	if errRes != nil {
+		return nil, errRes
+	}
+	byId := make(map[string]*DeveloperDetails, len(details))
+	for _, d := range details {
+		byId[d.ID] = d
+	}
+	return byId, nil
+}
+
+func (a *ApiManager) getCompaniesByIds(org string, ids []string) (map[string]*CompanyDetails, *common.ErrorResponse) {
+	coms, err := a.DbMan.GetCompaniesByIds(org, uniqueStrings(ids))
+	if err != nil {
+		log.Errorf("getCompaniesByIds: %v", err)
+		return nil, newDbError(err)
+	}
+	details, errRes := a.getCompaniesDetails(coms)
+	if errRes != nil {
+		return nil, errRes
+	}
+	byId := make(map[string]*CompanyDetails, len(details))
+	for _, d := range details {
+		byId[d.ID] = d
+	}
+	return byId, nil
+}
+
+// getAttributesByTenant returns the attributes of the entities, with one query per tenant
+func (a *ApiManager) getAttributesByTenant(idsByTenant map[string][]string) (map[string][]common.Attribute, *common.ErrorResponse) {
+	attrs := make(map[string][]common.Attribute)
+	for tenantId, ids := range idsByTenant {
+		tenantAttrs, err := a.DbMan.GetKmsAttributes(tenantId, ids...)
+		if err != nil {
+			log.Errorf("getAttributesByTenant: %v", err)
+			return nil, newDbError(err)
+		}
+		for id, attr := range tenantAttrs {
+			attrs[id] = attr
+		}
+	}
+	return attrs, nil
+}
+
+// appCredentialDetails returns the credentials of the app as returned by the appcredentials endpoint, from its details
+func appCredentialDetails(app *common.App, details *AppDetails) []*AppCredentialDetails {
+	devStatus := ""
+	if app.DeveloperId != "" {
+		devStatus = details.AppParentStatus
+	}
+	creds := make([]*AppCredentialDetails, 0, len(details.AppCredentials))
+	for _, cd := range details.AppCredentials {
+		creds = append(creds, &AppCredentialDetails{
+			AppID:             cd.AppID,
+			AppName:           app.Name,
+			Attributes:        cd.Attributes,
+			ConsumerKey:       cd.ConsumerKey,
+			ConsumerKeyStatus: makeConsumerKeyStatusDetails(app, cd, devStatus),
+			ConsumerSecret:    cd.ConsumerSecret,
+			DeveloperID:       app.DeveloperId,
+			RedirectUris:      []string{app.CallbackUrl},
+			Scopes:            cd.Scopes,
+			Status:            cd.Status,
+		})
+	}
+	return creds
+}
+
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	var unique []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
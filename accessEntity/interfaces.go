@@ -31,10 +31,32 @@ type DbManagerInterface interface {
 	GetCompanyDevelopers(org, priKey, priVal, secKey, secVal string) (companyDevelopers []common.CompanyDeveloper, err error)
 	GetAppCredentials(org, priKey, priVal, secKey, secVal string) (appCredentials []common.AppCredential, err error)
 	GetDevelopers(org, priKey, priVal, secKey, secVal string) (developers []common.Developer, err error)
+	// pages of the entities of an org, ordered by id, see ListIdentifierTree for the filters
+	ListApiProducts(org, filterKey, filterVal, after string, limit int) (apiProducts []common.ApiProduct, err error)
+	ListApps(org, filterKey, filterVal, after string, limit int) (apps []common.App, err error)
+	ListCompanies(org, filterKey, filterVal, after string, limit int) (companies []common.Company, err error)
+	ListDevelopers(org, filterKey, filterVal, after string, limit int) (developers []common.Developer, err error)
+	// related entities, fetched in batches of ids
+	GetApiProductIds(ids []string, idType string) (map[string][]string, error)
+	GetApiProductsByIds(org string, ids []string) (apiProducts []common.ApiProduct, err error)
+	GetCompaniesByIds(org string, ids []string) (companies []common.Company, err error)
+	GetDevelopersByIds(org string, ids []string) (developers []common.Developer, err error)
+	GetAppCredentialsByAppIds(org string, appIds []string) (appCredentials []common.AppCredential, err error)
+	GetApiProductNamesByIds(ids []string, idType string) (map[string][]string, error)
+	GetApiProductReferences(consumerKeys []string) (refs []common.ApiProductReference, err error)
+	GetComNamesByComIds(comIds []string) (map[string]string, error)
+	GetDevEmailsByDevIds(devIds []string) (map[string]string, error)
+	GetComNamesByDevIds(devIds []string) (map[string][]string, error)
+	GetAppNamesByIds(ids []string, t string) (map[string][]string, error)
+	GetStatuses(ids []string, t string) (map[string]string, error)
 	// utils
 	GetApiProductNames(id string, idType string) ([]string, error)
 	GetAppNames(id string, idType string) ([]string, error)
 	GetComNames(id string, idType string) ([]string, error)
 	GetDevEmailByDevId(devId string, org string) (string, error)
 	GetStatus(id, t string) (string, error)
+	MatchApiResource(prod *common.ApiProduct, resource string) (string, bool)
+	// snapshot consistency
+	PinDb() *common.DbPin
+	WithPin(pin *common.DbPin) DbManagerInterface
 }
@@ -0,0 +1,268 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accessEntity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/apid/apidApiMetadata/common"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// query parameters of list requests
+const (
+	// maximum number of entities of the page, defaultListLimit if absent
+	ParameterLimit = "limit"
+	// token returned with the previous page
+	ParameterContinuation = "continuation"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+/*
+ * ListIdentifierTree holds, by endpoint, the identifiers which may filter a list request, at most one per request.
+ * Requests without identifiers list all the entities of the org. Requests whose identifiers select a single
+ * entity, as described by IdentifierTree, are not list requests.
+ */
+var ListIdentifierTree = map[string][]string{
+	EndpointApiProduct: {},
+	EndpointApp:        {IdentifierDeveloperId, IdentifierDeveloperEmail, IdentifierCompanyName},
+	EndpointCompany:    {},
+	EndpointDeveloper:  {IdentifierCompanyName},
+}
+
+/*
+ * the position of a list in the pages of its request. It is only valid for the same endpoint and filter,
+ * and as pages are ordered by id, it stays valid when the snapshot changes between pages.
+ */
+type continuationToken struct {
+	Endpoint    string `json:"e"`
+	FilterKey   string `json:"k,omitempty"`
+	FilterValue string `json:"v,omitempty"`
+	// id of the last entity of the previous page
+	After string `json:"a"`
+}
+
+func encodeContinuation(t *continuationToken) string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeContinuation(s string) (*continuationToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", ParameterContinuation)
+	}
+	t := &continuationToken{}
+	if err = json.Unmarshal(b, t); err != nil || t.After == "" {
+		return nil, fmt.Errorf("invalid %s", ParameterContinuation)
+	}
+	return t, nil
+}
+
+// parseListFilter returns the filter of a list request, ok is false if the request is not one
+func parseListFilter(endpoint string, ids map[string]string) (key, val string, ok bool) {
+	filters, isList := ListIdentifierTree[endpoint]
+	if !isList {
+		return "", "", false
+	}
+	if valid, _ := parseIdentifiers(endpoint, ids); valid {
+		return "", "", false
+	}
+	switch len(ids) {
+	case 0:
+		return "", "", true
+	case 1:
+		for _, filter := range filters {
+			if val, ok := ids[filter]; ok {
+				return filter, val, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// listPage is the page requested by a list request, one more entity than its limit is queried to know if there is a next page
+type listPage struct {
+	after string
+	limit int
+}
+
+func parseListPage(endpoint, filterKey, filterVal string, pars url.Values) (*listPage, error) {
+	page := &listPage{limit: defaultListLimit}
+	if limit := pars.Get(ParameterLimit); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxListLimit {
+			return nil, fmt.Errorf("%s must be between 1 and %d", ParameterLimit, maxListLimit)
+		}
+		page.limit = l
+	}
+	if continuation := pars.Get(ParameterContinuation); continuation != "" {
+		t, err := decodeContinuation(continuation)
+		if err != nil {
+			return nil, err
+		}
+		if t.Endpoint != endpoint || t.FilterKey != filterKey || t.FilterValue != filterVal {
+			return nil, fmt.Errorf("%s does not belong to this list", ParameterContinuation)
+		}
+		page.after = t.After
+	}
+	return page, nil
+}
+
+// next returns the token of the page following the one ending with lastId
+func (p *listPage) next(endpoint, filterKey, filterVal, lastId string) string {
+	return encodeContinuation(&continuationToken{
+		Endpoint:    endpoint,
+		FilterKey:   filterKey,
+		FilterValue: filterVal,
+		After:       lastId,
+	})
+}
+
+func (a *ApiManager) listEntities(endpoint, org, filterKey, filterVal string, pars url.Values, expand expansion) (interface{}, *common.ErrorResponse) {
+	page, err := parseListPage(endpoint, filterKey, filterVal, pars)
+	if err != nil {
+		return nil, &common.ErrorResponse{
+			ResponseCode:    strconv.Itoa(INVALID_PARAMETERS),
+			ResponseMessage: err.Error(),
+			StatusCode:      http.StatusBadRequest,
+		}
+	}
+	switch endpoint {
+	case EndpointApiProduct:
+		return a.listApiProducts(org, filterKey, filterVal, page)
+	case EndpointApp:
+		return a.listApps(org, filterKey, filterVal, page, expand)
+	case EndpointCompany:
+		return a.listCompanies(org, filterKey, filterVal, page)
+	case EndpointDeveloper:
+		return a.listDevelopers(org, filterKey, filterVal, page)
+	}
+	return nil, ErrInvalidPar
+}
+
+func (a *ApiManager) listApiProducts(org, filterKey, filterVal string, page *listPage) (*ApiProductsSuccessResponse, *common.ErrorResponse) {
+	prods, err := a.DbMan.ListApiProducts(org, filterKey, filterVal, page.after, page.limit+1)
+	if err != nil {
+		log.Errorf("listApiProducts: %v", err)
+		return nil, newDbError(err)
+	}
+	more := len(prods) > page.limit
+	if more {
+		prods = prods[:page.limit]
+	}
+	details, errRes := a.getApiProductsDetails(prods)
+	if errRes != nil {
+		return nil, errRes
+	}
+	res := &ApiProductsSuccessResponse{
+		ApiProducts:            details,
+		Organization:           org,
+		PrimaryIdentifierType:  filterKey,
+		PrimaryIdentifierValue: filterVal,
+	}
+	if more {
+		res.Continuation = page.next(EndpointApiProduct, filterKey, filterVal, prods[len(prods)-1].Id)
+	}
+	return res, nil
+}
+
+func (a *ApiManager) listApps(org, filterKey, filterVal string, page *listPage, expand expansion) (*AppsSuccessResponse, *common.ErrorResponse) {
+	apps, err := a.DbMan.ListApps(org, filterKey, filterVal, page.after, page.limit+1)
+	if err != nil {
+		log.Errorf("listApps: %v", err)
+		return nil, newDbError(err)
+	}
+	more := len(apps) > page.limit
+	if more {
+		apps = apps[:page.limit]
+	}
+	details, errRes := a.getAppsDetails(org, apps)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if errRes := a.expandApps(org, apps, details, expand); errRes != nil {
+		return nil, errRes
+	}
+	res := &AppsSuccessResponse{
+		Apps:                   details,
+		Organization:           org,
+		PrimaryIdentifierType:  filterKey,
+		PrimaryIdentifierValue: filterVal,
+	}
+	if more {
+		res.Continuation = page.next(EndpointApp, filterKey, filterVal, apps[len(apps)-1].Id)
+	}
+	return res, nil
+}
+
+func (a *ApiManager) listCompanies(org, filterKey, filterVal string, page *listPage) (*CompaniesSuccessResponse, *common.ErrorResponse) {
+	coms, err := a.DbMan.ListCompanies(org, filterKey, filterVal, page.after, page.limit+1)
+	if err != nil {
+		log.Errorf("listCompanies: %v", err)
+		return nil, newDbError(err)
+	}
+	more := len(coms) > page.limit
+	if more {
+		coms = coms[:page.limit]
+	}
+	details, errRes := a.getCompaniesDetails(coms)
+	if errRes != nil {
+		return nil, errRes
+	}
+	res := &CompaniesSuccessResponse{
+		Companies:              details,
+		Organization:           org,
+		PrimaryIdentifierType:  filterKey,
+		PrimaryIdentifierValue: filterVal,
+	}
+	if more {
+		res.Continuation = page.next(EndpointCompany, filterKey, filterVal, coms[len(coms)-1].Id)
+	}
+	return res, nil
+}
+
+func (a *ApiManager) listDevelopers(org, filterKey, filterVal string, page *listPage) (*DevelopersSuccessResponse, *common.ErrorResponse) {
+	devs, err := a.DbMan.ListDevelopers(org, filterKey, filterVal, page.after, page.limit+1)
+	if err != nil {
+		log.Errorf("listDevelopers: %v", err)
+		return nil, newDbError(err)
+	}
+	more := len(devs) > page.limit
+	if more {
+		devs = devs[:page.limit]
+	}
+	details, errRes := a.getDevelopersDetails(EndpointDeveloper, org, devs)
+	if errRes != nil {
+		return nil, errRes
+	}
+	res := &DevelopersSuccessResponse{
+		Developers:             details,
+		Organization:           org,
+		PrimaryIdentifierType:  filterKey,
+		PrimaryIdentifierValue: filterVal,
+	}
+	if more {
+		res.Continuation = page.next(EndpointDeveloper, filterKey, filterVal, devs[len(devs)-1].Id)
+	}
+	return res, nil
+}
@@ -16,10 +16,14 @@ package accessEntity
 import (
 	"github.com/apid/apid-core/cipher"
 	"github.com/apid/apidApiMetadata/common"
+	tran "github.com/apigee-labs/transicator/common"
 	"strings"
 )
 
-const dummyEncryptPrefix = "encrypted:"
+const (
+	dummyEncryptPrefix   = "encrypted:"
+	dummyReferenceStatus = "APPROVED"
+)
 
 type DummyCipherMan struct {
 }
@@ -27,6 +31,12 @@ type DummyCipherMan struct {
 func (c *DummyCipherMan) AddOrgs(orgs []string) {
 }
 
+func (c *DummyCipherMan) RemoveOrgs(orgs []string) {
+}
+
+func (c *DummyCipherMan) Close() {
+}
+
 func (d *DummyCipherMan) TryDecryptBase64(input string, org string) (string, error) {
 	if strings.HasPrefix(input, dummyEncryptPrefix) {
 		return input[len(dummyEncryptPrefix):], nil
@@ -46,6 +56,7 @@ type DummyDbMan struct {
 	appCredentials    []common.AppCredential
 	developers        []common.Developer
 	apiProductNames   []string
+	apiProductIds     map[string][]string
 	appNames          []string
 	comNames          []string
 	email             string
@@ -65,14 +76,29 @@ func (d *DummyDbMan) GetDbVersion() string {
 	return ""
 }
 
-func (d *DummyDbMan) GetKmsAttributes(tenantId string, entities ...string) map[string][]common.Attribute {
-	return d.attrs
+func (d *DummyDbMan) InvalidateCache(changes []tran.Change) {
+}
+
+func (d *DummyDbMan) GetKmsAttributes(tenantId string, entities ...string) (map[string][]common.Attribute, error) {
+	return d.attrs, nil
 }
 
 func (d *DummyDbMan) GetApiProducts(org, priKey, priVal, secKey, secVal string) (apiProducts []common.ApiProduct, err error) {
 	return d.apiProducts, d.err
 }
 
+func (d *DummyDbMan) MatchApiResource(prod *common.ApiProduct, resource string) (string, bool) {
+	return common.MatchResource(common.JsonToStringArray(prod.ApiResources), resource)
+}
+
+func (d *DummyDbMan) PinDb() *common.DbPin {
+	return &common.DbPin{}
+}
+
+func (d *DummyDbMan) WithPin(pin *common.DbPin) DbManagerInterface {
+	return d
+}
+
 func (d *DummyDbMan) GetApps(org, priKey, priVal, secKey, secVal string) (apps []common.App, err error) {
 	return d.apps, d.err
 }
@@ -93,6 +119,102 @@ func (d *DummyDbMan) GetDevelopers(org, priKey, priVal, secKey, secVal string) (
 	return d.developers, d.err
 }
 
+func (d *DummyDbMan) ListApiProducts(org, filterKey, filterVal, after string, limit int) ([]common.ApiProduct, error) {
+	return d.apiProducts, d.err
+}
+
+func (d *DummyDbMan) ListApps(org, filterKey, filterVal, after string, limit int) ([]common.App, error) {
+	return d.apps, d.err
+}
+
+func (d *DummyDbMan) ListCompanies(org, filterKey, filterVal, after string, limit int) ([]common.Company, error) {
+	return d.companies, d.err
+}
+
+func (d *DummyDbMan) ListDevelopers(org, filterKey, filterVal, after string, limit int) ([]common.Developer, error) {
+	return d.developers, d.err
+}
+
+func (d *DummyDbMan) GetApiProductIds(ids []string, idType string) (map[string][]string, error) {
+	return d.apiProductIds, d.err
+}
+
+func (d *DummyDbMan) GetApiProductsByIds(org string, ids []string) ([]common.ApiProduct, error) {
+	return d.apiProducts, d.err
+}
+
+func (d *DummyDbMan) GetCompaniesByIds(org string, ids []string) ([]common.Company, error) {
+	return d.companies, d.err
+}
+
+func (d *DummyDbMan) GetDevelopersByIds(org string, ids []string) ([]common.Developer, error) {
+	return d.developers, d.err
+}
+
+func (d *DummyDbMan) GetAppCredentialsByAppIds(org string, appIds []string) ([]common.AppCredential, error) {
+	return d.appCredentials, d.err
+}
+
+func (d *DummyDbMan) GetApiProductNamesByIds(ids []string, idType string) (map[string][]string, error) {
+	names := make(map[string][]string)
+	for _, id := range ids {
+		names[id] = d.apiProductNames
+	}
+	return names, d.err
+}
+
+func (d *DummyDbMan) GetApiProductReferences(consumerKeys []string) ([]common.ApiProductReference, error) {
+	var refs []common.ApiProductReference
+	for _, key := range consumerKeys {
+		for _, name := range d.apiProductNames {
+			refs = append(refs, common.ApiProductReference{ConsumerKey: key, Name: name, Status: dummyReferenceStatus})
+		}
+	}
+	return refs, d.err
+}
+
+func (d *DummyDbMan) GetComNamesByComIds(comIds []string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, id := range comIds {
+		if len(d.comNames) > 0 {
+			names[id] = d.comNames[0]
+		}
+	}
+	return names, d.err
+}
+
+func (d *DummyDbMan) GetDevEmailsByDevIds(devIds []string) (map[string]string, error) {
+	emails := make(map[string]string)
+	for _, id := range devIds {
+		emails[id] = d.email
+	}
+	return emails, d.err
+}
+
+func (d *DummyDbMan) GetComNamesByDevIds(devIds []string) (map[string][]string, error) {
+	names := make(map[string][]string)
+	for _, id := range devIds {
+		names[id] = d.comNames
+	}
+	return names, d.err
+}
+
+func (d *DummyDbMan) GetAppNamesByIds(ids []string, t string) (map[string][]string, error) {
+	names := make(map[string][]string)
+	for _, id := range ids {
+		names[id] = d.appNames
+	}
+	return names, d.err
+}
+
+func (d *DummyDbMan) GetStatuses(ids []string, t string) (map[string]string, error) {
+	statuses := make(map[string]string)
+	for _, id := range ids {
+		statuses[id] = d.status
+	}
+	return statuses, d.err
+}
+
 func (d *DummyDbMan) GetApiProductNames(id string, idType string) ([]string, error) {
 	return d.apiProductNames, d.err
 }
@@ -0,0 +1,149 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accessEntity
+
+import (
+	"fmt"
+	"github.com/apid/apidApiMetadata/common"
+	"strings"
+)
+
+// how secret fields are returned
+const (
+	// the field is left out of the response
+	RedactOmit = "omit"
+	// the field is replaced by redactedMask
+	RedactMask = "mask"
+	// the field is encrypted with the key of the org, as with the encryption API
+	RedactEncrypt = "encrypt"
+	// the field is returned as is
+	RedactPlaintext = "plaintext"
+)
+
+// secret fields, named after their JSON names
+const (
+	FieldConsumerSecret = "consumerSecret"
+	FieldPassword       = "password"
+)
+
+const redactedMask = "********"
+
+// DefaultRedactionRules never return secrets in plaintext
+var DefaultRedactionRules = map[string]string{
+	FieldConsumerSecret: RedactMask,
+	FieldPassword:       RedactOmit,
+}
+
+/*
+ * RedactionPolicy decides how the secret fields of each endpoint are returned.
+ * The action of a field is looked up for the endpoint, then for all endpoints,
+ * and falls back to RedactOmit for fields without any rule.
+ * A nil *RedactionPolicy returns all fields in plaintext.
+ */
+type RedactionPolicy struct {
+	// {endpoint: {field: action}}, the endpoint "" applies to all endpoints
+	Rules map[string]map[string]string
+}
+
+/*
+ * CreateRedactionPolicy creates a policy from DefaultRedactionRules, overridden by the rules of spec.
+ * spec is a comma separated list of [endpoint:]field=action, for example
+ * "consumerSecret=omit,appcredentials:consumerSecret=encrypt".
+ */
+func CreateRedactionPolicy(spec string) (*RedactionPolicy, error) {
+	p := &RedactionPolicy{
+		Rules: map[string]map[string]string{"": {}},
+	}
+	for field, action := range DefaultRedactionRules {
+		p.Rules[""][field] = action
+	}
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		i := strings.Index(rule, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid redaction rule %q, expected [endpoint:]field=action", rule)
+		}
+		target, action := strings.TrimSpace(rule[:i]), strings.ToLower(strings.TrimSpace(rule[i+1:]))
+		switch action {
+		case RedactOmit, RedactMask, RedactEncrypt, RedactPlaintext:
+		default:
+			return nil, fmt.Errorf("invalid redaction action %q in rule %q", action, rule)
+		}
+		endpoint, field := "", target
+		if j := strings.Index(target, ":"); j >= 0 {
+			endpoint, field = "/"+strings.Trim(target[:j], "/ "), strings.TrimSpace(target[j+1:])
+			if IdentifierTree[endpoint] == nil {
+				return nil, fmt.Errorf("unknown endpoint %q in redaction rule %q", endpoint, rule)
+			}
+		}
+		if field == "" {
+			return nil, fmt.Errorf("invalid redaction rule %q, expected [endpoint:]field=action", rule)
+		}
+		if p.Rules[endpoint] == nil {
+			p.Rules[endpoint] = make(map[string]string)
+		}
+		p.Rules[endpoint][field] = action
+	}
+	return p, nil
+}
+
+func (p *RedactionPolicy) action(endpoint, field string) string {
+	if p == nil {
+		return RedactPlaintext
+	}
+	if action, ok := p.Rules[endpoint][field]; ok {
+		return action
+	}
+	if action, ok := p.Rules[""][field]; ok {
+		return action
+	}
+	return RedactOmit
+}
+
+/*
+ * redact returns the value of the secret field as the policy requires, "" meaning omitted.
+ * If the value cannot be encrypted, it is omitted.
+ */
+func (p *RedactionPolicy) redact(endpoint, field, value, org string, cipherMan common.CipherManagerInterface) string {
+	if value == "" {
+		return ""
+	}
+	switch p.action(endpoint, field) {
+	case RedactPlaintext:
+		return value
+	case RedactMask:
+		return redactedMask
+	case RedactEncrypt:
+		if cipherMan == nil {
+			log.Errorf("No cipher manager to encrypt %s of %s, omitting it", field, endpoint)
+			return ""
+		}
+		encrypted, err := cipherMan.EncryptBase64(value, org, "", "")
+		if err != nil {
+			log.Errorf("Failed to encrypt %s of %s for org %s, omitting it: %v", field, endpoint, org, err)
+			return ""
+		}
+		if encrypted == value {
+			// the org has no key, the value was not encrypted
+			log.Warnf("No encryption key for org %s, omitting %s of %s", org, field, endpoint)
+			return ""
+		}
+		return encrypted
+	}
+	return ""
+}
@@ -0,0 +1,210 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// formats of the attributes of responses
+const (
+	// a list of {"name": ..., "value": ...} objects, as stored
+	AttributesFormatList = "list"
+	// a {name: value} object
+	AttributesFormatMap = "map"
+)
+
+// JSON name of the attribute lists of responses
+const attributesField = "attributes"
+
+/*
+ * AttributeOptions select the attributes returned in responses and how they are formatted.
+ * The zero value returns all attributes as a list of string values.
+ */
+type AttributeOptions struct {
+	// names of the attributes to return, all of them if empty
+	Names []string
+	// AttributesFormatList or AttributesFormatMap, "" meaning a list
+	Format string
+	// if true, values holding JSON objects, arrays, numbers or booleans are returned decoded instead of as strings
+	Typed bool
+}
+
+// ParseAttributeNames splits comma separated lists of attribute names, ignoring blank names.
+func ParseAttributeNames(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Validate checks the format of the options.
+func (o *AttributeOptions) Validate() error {
+	switch o.Format {
+	case "", AttributesFormatList, AttributesFormatMap:
+		return nil
+	}
+	return fmt.Errorf("invalid attributes format %q, expected %s or %s", o.Format, AttributesFormatList, AttributesFormatMap)
+}
+
+// IsDefault is true if the options return attributes as stored.
+func (o *AttributeOptions) IsDefault() bool {
+	return o == nil || (len(o.Names) == 0 && o.Format != AttributesFormatMap && !o.Typed)
+}
+
+// FilterAttributes returns the attributes whose names are selected, in their order.
+func (o *AttributeOptions) FilterAttributes(attrs []Attribute) []Attribute {
+	if o == nil || len(o.Names) == 0 || attrs == nil {
+		return attrs
+	}
+	filtered := make([]Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		if o.selects(attr.Name) {
+			filtered = append(filtered, attr)
+		}
+	}
+	return filtered
+}
+
+func (o *AttributeOptions) selects(name string) bool {
+	if len(o.Names) == 0 {
+		return true
+	}
+	for _, n := range o.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * value returns the value of an attribute, decoded if typed values are requested and it holds
+ * a JSON object, array, number or boolean. JSON strings and null are left as they are,
+ * so that decoding never changes the type of a plain string value.
+ */
+func (o *AttributeOptions) value(value string) interface{} {
+	if !o.Typed {
+		return value
+	}
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || trimmed[0] == '"' || trimmed == "null" {
+		return value
+	}
+	decoded, err := decodeJson([]byte(trimmed))
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+/*
+ * ShapeResponse returns the response with each of its attribute lists filtered and formatted,
+ * to be marshalled in its place. Responses are returned as they are with the default options.
+ */
+func (o *AttributeOptions) ShapeResponse(response interface{}) (interface{}, error) {
+	if o.IsDefault() {
+		return response, nil
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	generic, err := decodeJson(b)
+	if err != nil {
+		return nil, err
+	}
+	return o.shape(generic), nil
+}
+
+// shape walks a decoded JSON value, replacing its attribute lists
+func (o *AttributeOptions) shape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if list, ok := field.([]interface{}); ok && key == attributesField && isAttributeList(list) {
+				v[key] = o.shapeAttributes(list)
+			} else {
+				v[key] = o.shape(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = o.shape(v[i])
+		}
+	}
+	return v
+}
+
+func (o *AttributeOptions) shapeAttributes(list []interface{}) interface{} {
+	if o.Format == AttributesFormatMap {
+		values := make(map[string]interface{})
+		for _, item := range list {
+			attr := item.(map[string]interface{})
+			name, _ := attr["name"].(string)
+			if o.selects(name) {
+				value, _ := attr["value"].(string)
+				values[name] = o.value(value)
+			}
+		}
+		return values
+	}
+	shaped := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		attr := item.(map[string]interface{})
+		name, _ := attr["name"].(string)
+		if o.selects(name) {
+			value, _ := attr["value"].(string)
+			attr["value"] = o.value(value)
+			shaped = append(shaped, attr)
+		}
+	}
+	return shaped
+}
+
+// isAttributeList is true if all items of the list are marshalled attributes
+func isAttributeList(list []interface{}) bool {
+	for _, item := range list {
+		attr, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok = attr["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeJson decodes numbers as json.Number, so that they are marshalled back without loss of precision
+func decodeJson(b []byte) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
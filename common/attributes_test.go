@@ -0,0 +1,112 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Attribute Options", func() {
+	type entity struct {
+		Id         string      `json:"id"`
+		Attributes []Attribute `json:"attributes"`
+		Children   []entity    `json:"children,omitempty"`
+	}
+	attrs := []Attribute{
+		{Name: "plain", Value: "foo"},
+		{Name: "blob", Value: `{"tier": "gold", "limits": [1, 2]}`},
+		{Name: "count", Value: "12345678901234567890"},
+		{Name: "flag", Value: " true "},
+		{Name: "quoted", Value: `"bar"`},
+		{Name: "broken", Value: "{not json"},
+	}
+	marshal := func(opts *AttributeOptions, v interface{}) string {
+		shaped, err := opts.ShapeResponse(v)
+		Expect(err).Should(Succeed())
+		b, err := json.Marshal(shaped)
+		Expect(err).Should(Succeed())
+		return string(b)
+	}
+
+	It("should parse attribute names", func() {
+		Expect(ParseAttributeNames([]string{"a, b", "", " c ,,"})).Should(Equal([]string{"a", "b", "c"}))
+		Expect(ParseAttributeNames(nil)).Should(BeEmpty())
+	})
+
+	It("should validate the format", func() {
+		Expect((&AttributeOptions{}).Validate()).Should(Succeed())
+		Expect((&AttributeOptions{Format: AttributesFormatMap}).Validate()).Should(Succeed())
+		Expect((&AttributeOptions{Format: "xml"}).Validate()).ShouldNot(Succeed())
+	})
+
+	It("should filter attributes by name", func() {
+		opts := &AttributeOptions{Names: []string{"count", "plain", "missing"}}
+		Expect(opts.FilterAttributes(attrs)).Should(Equal([]Attribute{attrs[0], attrs[2]}))
+		Expect(opts.FilterAttributes(nil)).Should(BeNil())
+		Expect((&AttributeOptions{}).FilterAttributes(attrs)).Should(Equal(attrs))
+		var none *AttributeOptions
+		Expect(none.FilterAttributes(attrs)).Should(Equal(attrs))
+	})
+
+	It("should return responses as they are with the default options", func() {
+		e := &entity{Id: "e1", Attributes: attrs}
+		for _, opts := range []*AttributeOptions{nil, {}, {Format: AttributesFormatList}} {
+			shaped, err := opts.ShapeResponse(e)
+			Expect(err).Should(Succeed())
+			Expect(shaped).Should(BeIdenticalTo(e))
+		}
+	})
+
+	It("should return attributes as an object", func() {
+		e := entity{
+			Id:         "e1",
+			Attributes: attrs[:2],
+			Children:   []entity{{Id: "e2", Attributes: []Attribute{}}, {Id: "e3"}},
+		}
+		Expect(marshal(&AttributeOptions{Format: AttributesFormatMap}, e)).Should(MatchJSON(`{
+			"id": "e1",
+			"attributes": {"plain": "foo", "blob": "{\"tier\": \"gold\", \"limits\": [1, 2]}"},
+			"children": [{"id": "e2", "attributes": {}}, {"id": "e3", "attributes": null}]
+		}`))
+	})
+
+	It("should decode typed values", func() {
+		e := entity{Id: "e1", Attributes: attrs}
+		Expect(marshal(&AttributeOptions{Format: AttributesFormatMap, Typed: true}, e)).Should(MatchJSON(`{
+			"id": "e1",
+			"attributes": {
+				"plain": "foo",
+				"blob": {"tier": "gold", "limits": [1, 2]},
+				"count": 12345678901234567890,
+				"flag": true,
+				"quoted": "\"bar\"",
+				"broken": "{not json"
+			}
+		}`))
+		Expect(marshal(&AttributeOptions{Names: []string{"blob"}, Typed: true}, e)).Should(MatchJSON(`{
+			"id": "e1",
+			"attributes": [{"name": "blob", "value": {"tier": "gold", "limits": [1, 2]}}]
+		}`))
+	})
+
+	It("should keep the precision of numbers outside attributes", func() {
+		v := map[string]interface{}{"issuedAt": int64(1503100000123456789), "attributes": attrs[:1]}
+		Expect(marshal(&AttributeOptions{Typed: true}, v)).Should(MatchJSON(`{
+			"issuedAt": 1503100000123456789,
+			"attributes": [{"name": "plain", "value": "foo"}]
+		}`))
+	})
+})
@@ -14,12 +14,18 @@
 package common
 
 import (
+	"context"
+	"crypto/aes"
+	gocipher "crypto/cipher"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"github.com/apid/apid-core/cipher"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"regexp"
 	"strings"
@@ -27,14 +33,29 @@ import (
 	"time"
 )
 
-const regEncrypted = `^\{[0-9A-Za-z]+/[0-9A-Za-z]+/[0-9A-Za-z]+\}.`
+// the optional fourth field is the id of the key
+const regEncrypted = `^\{[0-9A-Za-z]+/[0-9A-Za-z]+/[0-9A-Za-z]+(/[0-9A-Za-z_.-]+)?\}.`
 const retrieveEncryptKeyPath = "/encryptionkey"
 const EncryptAes = "AES"
 
 const (
 	retrieveKeyRetryInterval = time.Duration(5 * time.Second)
 	retrieveKeyTimeout       = time.Duration(5 * time.Minute)
+	maxRetrieveBackoff       = time.Duration(time.Minute)
+	// number of goroutines retrieving keys in the background
+	maxRetrieveWorkers = 4
 )
+const DefaultKeyRefreshInterval = time.Duration(time.Hour)
+const DefaultEncryptionMode = ModeGcm
+
+// how long an org without key is not asked for again in the request path
+const noKeyTTL = time.Duration(5 * time.Minute)
+
+// how long a key id unknown to KMS does not trigger a retrieval again in the request path
+const unknownKeyIdTTL = time.Duration(5 * time.Minute)
+
+// number of keys kept per org, the current one included
+const maxOrgKeys = 3
 const parameterOrganization = "organization"
 const configBearerToken = "apigeesync_bearer_token"
 const headerContentType = "Content-Type"
@@ -46,141 +67,548 @@ const errorCodeNoKey = "organizations.EncryptionKeyDoesNotExist"
 
 var RegexpEncrypted = regexp.MustCompile(regEncrypted)
 
+// CreateCipherManager creates a cipher manager retrieving keys from the KMS server.
 func CreateCipherManager(client *http.Client, serverUrlBase string) *KmsCipherManager {
+	return CreateCipherManagerWithSource(CreateHttpKeySource(client, serverUrlBase))
+}
+
+func CreateCipherManagerWithSource(source KeySource) *KmsCipherManager {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &KmsCipherManager{
-		serverUrlBase: serverUrlBase,
-		aes:           make(map[string]*cipher.AesCipher),
-		mutex:         &sync.RWMutex{},
-		client:        client,
-		interval:      retrieveKeyRetryInterval,
-		timeout:       retrieveKeyTimeout,
+		ctx:         ctx,
+		cancel:      cancel,
+		retrieving:  make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		source:      source,
+		keys:        make(map[string][]*orgKey),
+		orgs:        make(map[string]bool),
+		mutex:       &sync.RWMutex{},
+		interval:    retrieveKeyRetryInterval,
+		timeout:     retrieveKeyTimeout,
+		noKey:       make(map[string]time.Time),
+		noKeyTTL:    noKeyTTL,
+		fetches:     make(map[string]*keyFetch),
+		unknownIds:  make(map[string]map[string]time.Time),
+		unknownTTL:  unknownKeyIdTTL,
+		fetchStatus: make(map[string]*keyFetchStatus),
+		breaker:     createKeyServerBreaker(keyServerFailureThreshold, keyServerCooldown),
+		defaultMode: DefaultEncryptionMode,
 	}
 }
 
+// SetEncryptionMode sets the mode of encryptions which do not specify one,
+// and whether unauthenticated modes are rejected for encryptions. Decryption accepts all modes.
+func (c *KmsCipherManager) SetEncryptionMode(defaultMode cipher.Mode, strict bool) error {
+	if err := validateMode(defaultMode, defaultPadding(defaultMode)); err != nil {
+		return err
+	}
+	if strict && !isAuthenticated(defaultMode) {
+		return fmt.Errorf("unauthenticated default mode %v is not allowed in strict mode", defaultMode)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.defaultMode = defaultMode
+	c.strict = strict
+	return nil
+}
+
 type KmsCipherManager struct {
-	serverUrlBase string
-	// org-level AesCipher map {organization: AesCipher}
-	aes      map[string]*cipher.AesCipher
+	source KeySource
+	// cancelled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	// orgs queued or under retrieval by the workers
+	retrieving map[string]bool
+	tasks      []retrieveTask
+	// signals the workers that tasks are queued
+	wake        chan struct{}
+	workersOnce sync.Once
+	// org-level keys {organization: keys}, from the current one to the oldest
+	keys map[string][]*orgKey
+	// orgs whose keys are refreshed
+	orgs     map[string]bool
 	mutex    *sync.RWMutex
-	client   *http.Client
 	interval time.Duration
 	timeout  time.Duration
+	// closed to stop the key refresh
+	stopRefresh chan struct{}
+	// orgs known to have no key {organization: time until which this is trusted}
+	noKey    map[string]time.Time
+	noKeyTTL time.Duration
+	// ongoing retrievals in the request path {organization: retrieval}
+	fetches map[string]*keyFetch
+	// key ids still unknown after a retrieval {organization: {key id: time until which this is trusted}}
+	unknownIds map[string]map[string]time.Time
+	unknownTTL time.Duration
+	// outcome of the last retrievals {organization: status}
+	fetchStatus map[string]*keyFetchStatus
+	// retrievals which waited for a concurrent one of the same org
+	sharedFetches uint64
+	breaker       *keyServerBreaker
+	// mode of encryptions which do not specify one
+	defaultMode cipher.Mode
+	// if true, only authenticated modes are used for encryptions
+	strict bool
 }
 
+// a retrieval of the key of an org by the workers
+type retrieveTask struct {
+	org string
+	// failed attempts so far
+	attempt int
+	// no retry after this time
+	deadline time.Time
+}
+
+// a retrieval of the key of an org, shared by concurrent callers
+type keyFetch struct {
+	// closed once err is set
+	done chan struct{}
+	err  error
+}
+
+type KmsCipherStats struct {
+	// orgs known to have no key
+	NoKeyOrgs int
+	// retrievals which waited for a concurrent one of the same org
+	SharedFetches uint64
+	// state of the key server circuit breaker, and its consecutive failures
+	KeyServerState    string
+	KeyServerFailures int
+}
+
+// an encryption key of an org
+type orgKey struct {
+	// id from KMS, or a fingerprint of the key if KMS has none
+	id string
+	// if true, the id came from KMS and is written in ciphertexts
+	kmsId bool
+	// sha256 of the key, truncated, safe to display
+	fingerprint string
+	aes         *cipher.AesCipher
+	block       gocipher.Block
+	gcm         gocipher.AEAD
+}
+
+// AddOrgs queues the retrieval of the keys of the orgs, unless they are already retrieved or being retrieved.
 func (c *KmsCipherManager) AddOrgs(orgs []string) {
+	c.workersOnce.Do(c.startWorkers)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	deadline := now.Add(c.timeout)
 	for _, org := range orgs {
-		go c.startRetrieve(org, c.interval, c.timeout)
+		c.orgs[org] = true
+		if noKeyUntil, noKey := c.noKey[org]; (noKey && now.Before(noKeyUntil)) || c.retrieving[org] || len(c.keys[org]) > 0 {
+			continue
+		}
+		c.retrieving[org] = true
+		c.tasks = append(c.tasks, retrieveTask{org: org, deadline: deadline})
 	}
+	c.signalWorkers()
 }
 
-func (c *KmsCipherManager) startRetrieve(org string, interval time.Duration, timeout time.Duration) {
-	timeoutChan := time.After(timeout)
-	if err := c.retrieveKey(org); err != nil {
-		log.Error(err)
-	} else {
+// Close cancels the key retrievals, ongoing ones included, and stops the key refresh.
+func (c *KmsCipherManager) Close() {
+	c.StopKeyRefresh()
+	c.cancel()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, task := range c.tasks {
+		delete(c.retrieving, task.org)
+	}
+	c.tasks = nil
+}
+
+func (c *KmsCipherManager) startWorkers() {
+	for i := 0; i < maxRetrieveWorkers; i++ {
+		go c.retrieveWorker()
+	}
+}
+
+// must be called with the mutex held
+func (c *KmsCipherManager) signalWorkers() {
+	if len(c.tasks) == 0 {
 		return
 	}
-	ticker := time.NewTicker(interval)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *KmsCipherManager) retrieveWorker() {
+	for {
+		task, ok := c.nextTask()
+		if !ok {
+			return
+		}
+		c.runTask(task)
+	}
+}
+
+// nextTask waits for a queued task, it returns false once the manager is closed
+func (c *KmsCipherManager) nextTask() (retrieveTask, bool) {
 	for {
+		if c.ctx.Err() != nil {
+			return retrieveTask{}, false
+		}
+		c.mutex.Lock()
+		if len(c.tasks) > 0 {
+			task := c.tasks[0]
+			c.tasks = c.tasks[1:]
+			c.signalWorkers()
+			c.mutex.Unlock()
+			return task, true
+		}
+		c.mutex.Unlock()
 		select {
-		case <-timeoutChan:
-			log.Error("timeout when retrieving key")
+		case <-c.ctx.Done():
+			return retrieveTask{}, false
+		case <-c.wake:
+		}
+	}
+}
+
+// runTask retrieves the key of the org, and schedules a retry with backoff if that fails before the deadline
+func (c *KmsCipherManager) runTask(task retrieveTask) {
+	c.mutex.RLock()
+	added := c.orgs[task.org]
+	c.mutex.RUnlock()
+	// the org was removed meanwhile
+	if !added {
+		c.finishTask(task)
+		return
+	}
+	err := c.retrieveKey(task.org)
+	if err == nil || c.ctx.Err() != nil {
+		c.finishTask(task)
+		return
+	}
+	log.Error(err)
+	if !time.Now().Before(task.deadline) {
+		log.Errorf("timeout when retrieving key for org=%s", task.org)
+		c.finishTask(task)
+		return
+	}
+	delay := retrieveBackoff(task.attempt, c.interval, maxRetrieveBackoff)
+	task.attempt++
+	log.Debugf("Retrying to retrieve key for org=%s in %v", task.org, delay)
+	time.AfterFunc(delay, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.ctx.Err() != nil {
+			delete(c.retrieving, task.org)
 			return
-		case <-ticker.C:
-			if err := c.retrieveKey(org); err != nil {
-				log.Error(err)
-			} else {
+		}
+		c.tasks = append(c.tasks, task)
+		c.signalWorkers()
+	})
+}
+
+func (c *KmsCipherManager) finishTask(task retrieveTask) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.retrieving, task.org)
+}
+
+// retrieveBackoff returns the delay before the retry following the attempt:
+// doubling from base for each attempt up to max, with its upper half randomized.
+func retrieveBackoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func (c *KmsCipherManager) RemoveOrgs(orgs []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, org := range orgs {
+		delete(c.keys, org)
+		delete(c.orgs, org)
+		delete(c.noKey, org)
+		delete(c.unknownIds, org)
+		delete(c.fetchStatus, org)
+	}
+}
+
+// StartKeyRefresh retrieves the keys of all orgs every interval, so that rotated keys are picked up.
+// A non-positive interval disables the refresh.
+func (c *KmsCipherManager) StartKeyRefresh(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopRefresh != nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.stopRefresh = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-c.ctx.Done():
 				return
+			case <-ticker.C:
+				c.refreshKeys()
 			}
 		}
-	}
+	}()
 }
 
-func (c *KmsCipherManager) retrieveKey(org string) error {
-	var key []byte
-	req, err := http.NewRequest(http.MethodGet, c.serverUrlBase+retrieveEncryptKeyPath, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create retrieving key request for org=%s : %v", org, err)
-	}
-	pars := req.URL.Query()
-	pars[parameterOrganization] = []string{org}
-	req.URL.RawQuery = pars.Encode()
-	req.Header.Set("Authorization", "Bearer "+services.Config().GetString(configBearerToken))
-	log.Debugf("Retrieving key: %s", req.URL.String())
-	res, err := c.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve key for org=%s : %v", org, err)
+func (c *KmsCipherManager) StopKeyRefresh() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopRefresh != nil {
+		close(c.stopRefresh)
+		c.stopRefresh = nil
 	}
+}
 
-	// if 404
-	if res.StatusCode == http.StatusNotFound {
-		e, err := parseErrorResponse(res)
-		if err != nil {
-			log.Errorf("Failed to parse 404 error response for org %s: %v", org, err)
-			return err
+func (c *KmsCipherManager) Stats() KmsCipherStats {
+	stats := KmsCipherStats{}
+	stats.KeyServerState, stats.KeyServerFailures = c.breaker.stats()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stats.NoKeyOrgs = len(c.noKey)
+	stats.SharedFetches = c.sharedFetches
+	return stats
+}
+
+func (c *KmsCipherManager) refreshKeys() {
+	log.Debugf("Refreshing encryption keys, stats: %+v", c.Stats())
+	c.mutex.RLock()
+	orgs := make([]string, 0, len(c.orgs))
+	for org := range c.orgs {
+		orgs = append(orgs, org)
+	}
+	for org := range c.keys {
+		if !c.orgs[org] {
+			orgs = append(orgs, org)
 		}
-		// is this org has no key, stop retrying
-		if e.Code == errorCodeNoKey {
-			log.Debugf("No key is associated with org %v", org)
-			return nil
+	}
+	c.mutex.RUnlock()
+	for _, org := range orgs {
+		if err := c.retrieveKey(org); err != nil {
+			log.Errorf("Failed to refresh encryption key for org=%s : %v", org, err)
 		}
 	}
+}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to retrieve key for org [%v] with status: %v", org, res.Status)
+// retrieveKey retrieves the current key of the org, and records the outcome for KeyStatuses.
+// An org without key is not an error.
+func (c *KmsCipherManager) retrieveKey(org string) error {
+	err := c.loadKey(org)
+	absent := err == ErrNoKey
+	if absent {
+		err = nil
 	}
+	c.recordFetch(org, time.Now(), absent, err)
+	return err
+}
 
-	log.Debugf("Downloaded Encryption Key for org %s", org)
-	key64, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		return fmt.Errorf("error reading encryption key: %v", err)
+// loadKey retrieves the current key of the org, it returns ErrNoKey if the org has none
+func (c *KmsCipherManager) loadKey(org string) error {
+	if !c.breaker.allow(time.Now()) {
+		return fmt.Errorf("key server circuit breaker open, not retrieving key for org=%s", org)
+	}
+	key, err := c.source.GetKey(c.ctx, org)
+	c.breaker.record(err == nil || err == ErrNoKey, time.Now())
+	// is this org has no key, stop retrying
+	if err == ErrNoKey {
+		log.Debugf("No key is associated with org %v", org)
+		c.mutex.Lock()
+		c.noKey[org] = time.Now().Add(c.noKeyTTL)
+		c.mutex.Unlock()
+		return ErrNoKey
 	}
-	key, err = base64.StdEncoding.DecodeString(string(key64))
 	if err != nil {
-		return fmt.Errorf("error decoding encryption key: %v", err)
+		return err
 	}
 	log.Debugf("Encryption Key successfully retrieved for org %s", org)
+	if err = c.setKey(org, key.Id, key.Key); err != nil {
+		return fmt.Errorf("CreateAesCipher error for org [%v] when CreateAesCipher: %v", org, err)
+	}
+	return nil
+}
+
+/*
+ * setKey makes the key the current one of the org, and keeps the previous ones
+ * to decrypt what was encrypted before a rotation.
+ * An empty id is replaced by a fingerprint of the key.
+ */
+func (c *KmsCipherManager) setKey(org string, id string, key []byte) error {
 	a, err := cipher.CreateAesCipher(key)
 	if err != nil {
-		return fmt.Errorf("CreateAesCipher error for org [%v] when CreateAesCipher: %v", org, err)
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := gocipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(key)
+	k := &orgKey{id: id, kmsId: id != "", fingerprint: hex.EncodeToString(sum[:8]), aes: a, block: block, gcm: gcm}
+	if id == "" {
+		k.id = k.fingerprint
 	}
 	c.mutex.Lock()
-	c.aes[org] = a
-	c.mutex.Unlock()
+	defer c.mutex.Unlock()
+	delete(c.noKey, org)
+	delete(c.unknownIds[org], k.id)
+	keys := c.keys[org]
+	if len(keys) > 0 && keys[0].id == k.id {
+		return nil
+	}
+	if len(keys) > 0 {
+		log.Infof("Encryption key of org %s rotated from %s to %s", org, keys[0].id, k.id)
+	}
+	rotated := []*orgKey{k}
+	for _, old := range keys {
+		if old.id != k.id && len(rotated) < maxOrgKeys {
+			rotated = append(rotated, old)
+		}
+	}
+	c.keys[org] = rotated
 	return nil
 }
 
-// return val is nullable
-func (c *KmsCipherManager) getAesCipher(org string) *cipher.AesCipher {
+/*
+ * getKeys returns the keys of the org from the current one, retrieving them if there is none.
+ * Orgs known to have no key are not retrieved again until their noKeyTTL has passed.
+ */
+func (c *KmsCipherManager) getKeys(org string) []*orgKey {
 	// if exists
 	c.mutex.RLock()
-	if a := c.aes[org]; a != nil {
+	if keys := c.keys[org]; len(keys) > 0 {
 		c.mutex.RUnlock()
-		return a
+		return keys
 	}
+	noKeyUntil, noKey := c.noKey[org]
 	// if not exists
 	c.mutex.RUnlock()
-	if err := c.retrieveKey(org); err != nil {
+	if noKey && time.Now().Before(noKeyUntil) {
+		log.Debugf("Org %s has no encryption key, not retrieving it before %v", org, noKeyUntil)
+		return nil
+	}
+	if err := c.fetchKey(org); err != nil {
 		log.Errorf("Failed to get encryption key for org=%s : %v", org, err)
 		return nil
 	}
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	return c.aes[org]
+	return c.keys[org]
+}
+
+/*
+ * getDecryptionKeys returns the key with the id, or all keys of the org if id is empty.
+ * An unknown id is retrieved, as the key may have been rotated since the last refresh,
+ * and is not retrieved again until unknownTTL has passed if KMS does not know it either.
+ */
+func (c *KmsCipherManager) getDecryptionKeys(org string, id string) []*orgKey {
+	keys := c.getKeys(org)
+	if id == "" {
+		return keys
+	}
+	if k := findKey(keys, id); k != nil {
+		return []*orgKey{k}
+	}
+	c.mutex.RLock()
+	unknownUntil, unknown := c.unknownIds[org][id]
+	c.mutex.RUnlock()
+	if unknown && time.Now().Before(unknownUntil) {
+		log.Debugf("Encryption key %s of org %s is unknown, not retrieving it before %v", id, org, unknownUntil)
+		return nil
+	}
+	if err := c.fetchKey(org); err != nil {
+		log.Errorf("Failed to get encryption key %s for org=%s : %v", id, org, err)
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if k := findKey(c.keys[org], id); k != nil {
+		return []*orgKey{k}
+	}
+	c.setUnknownId(org, id, time.Now())
+	return nil
+}
+
+// setUnknownId records the key id as unknown, dropping the expired ones. It must be called with the mutex held.
+func (c *KmsCipherManager) setUnknownId(org string, id string, now time.Time) {
+	ids := c.unknownIds[org]
+	if ids == nil {
+		ids = make(map[string]time.Time)
+		c.unknownIds[org] = ids
+	}
+	for unknownId, until := range ids {
+		if !now.Before(until) {
+			delete(ids, unknownId)
+		}
+	}
+	ids[id] = now.Add(c.unknownTTL)
+}
+
+// fetchKey retrieves the key of the org, sharing the outcome with concurrent callers for the same org
+func (c *KmsCipherManager) fetchKey(org string) error {
+	c.mutex.Lock()
+	if f := c.fetches[org]; f != nil {
+		c.sharedFetches++
+		c.mutex.Unlock()
+		log.Debugf("Waiting for the ongoing retrieval of the encryption key for org=%s", org)
+		<-f.done
+		return f.err
+	}
+	f := &keyFetch{done: make(chan struct{})}
+	c.fetches[org] = f
+	c.mutex.Unlock()
+
+	f.err = c.retrieveKey(org)
+	c.mutex.Lock()
+	delete(c.fetches, org)
+	c.mutex.Unlock()
+	close(f.done)
+	return f.err
+}
+
+func findKey(keys []*orgKey, id string) *orgKey {
+	for _, k := range keys {
+		if k.id == id {
+			return k
+		}
+	}
+	return nil
 }
 
 // If input is encrypted, it decodes the input with base64,
 // and then decrypt it. Otherwise, original input is returned.
 // An encrypted input should be ciphertext prepended with algorithm. An unencrypted input can have any other format.
 // An example of encrypted input is "{AES/ECB/PKCS5Padding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=".
+// The algorithm may be followed by the id of the key, as in "{AES/ECB/PKCS5Padding/key1}...".
+// Without key id, the current key of the org is tried first, then the previous ones.
 func (c *KmsCipherManager) TryDecryptBase64(input string, org string) (output string, err error) {
 	if !IsEncrypted(input) {
 		output = input
 		return
 	}
 
-	text, mode, padding, err := GetCiphertext(input)
+	text, keyId, mode, padding, err := ParseCiphertext(input)
 	if err != nil {
 		log.Errorf("Get ciphertext of [%v] failed: [%v], considered as unencrypted!", input, err)
 		return
@@ -190,34 +618,59 @@ func (c *KmsCipherManager) TryDecryptBase64(input string, org string) (output st
 		log.Errorf("Decode base64 of [%v] failed: [%v], considered as unencrypted!", text, err)
 		return
 	}
-	aes := c.getAesCipher(org)
-	if aes == nil {
+	keys := c.getDecryptionKeys(org, keyId)
+	if len(keys) == 0 {
 		err = fmt.Errorf("failed to get decryption key for org: %s", org)
 		return
 	}
-	plaintext, err := aes.Decrypt(bytes, mode, padding)
-	if err != nil {
-		log.Errorf("Decrypt of [%v] failed: [%v], considered as unencrypted!", bytes, err)
-		return
+	var plaintext []byte
+	for _, k := range keys {
+		if plaintext, err = k.decrypt(bytes, mode, padding); err == nil {
+			output = string(plaintext)
+			return
+		}
 	}
-	output = string(plaintext)
+	log.Errorf("Decrypt of [%v] failed: [%v], considered as unencrypted!", bytes, err)
 	return
 }
 
-// It encrypts the input, and then encodes the ciphertext with base64.
-// The returned string is the base64 encoding of the encrypted input, prepended with algorithm.
+// It encrypts the input with the current key of the org, and then encodes the ciphertext with base64.
+// The returned string is the base64 encoding of the encrypted input, prepended with algorithm,
+// and the key id if KMS provided one.
 // An example output is "{AES/ECB/PKCS5Padding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4="
+// An empty mode is the default one, and an empty padding the one of the mode.
+// In strict mode, only authenticated modes are accepted.
 func (c *KmsCipherManager) EncryptBase64(input string, org string, mode cipher.Mode, padding cipher.Padding) (output string, err error) {
-	aes := c.getAesCipher(org)
+	c.mutex.RLock()
+	defaultMode, strict := c.defaultMode, c.strict
+	c.mutex.RUnlock()
+	if mode == "" {
+		mode = defaultMode
+	}
+	if padding == "" {
+		padding = defaultPadding(mode)
+	}
+	if err = validateMode(mode, padding); err != nil {
+		return
+	}
+	if strict && !isAuthenticated(mode) {
+		err = fmt.Errorf("unauthenticated mode %v is not allowed in strict mode", mode)
+		return
+	}
+	keys := c.getKeys(org)
 	// TODO: make sure this logic is expected
 	// if failed to get key and cipher, considered this org as unencrypted
-	if aes == nil {
+	if len(keys) == 0 {
 		return input, nil
 	}
-	ciphertext, err := aes.Encrypt([]byte(input), mode, padding)
+	ciphertext, err := keys[0].encrypt([]byte(input), mode, padding)
 	if err != nil {
 		return
 	}
+	if keys[0].kmsId {
+		output = fmt.Sprintf("{%s/%s/%s/%s}%s", EncryptAes, mode, padding, keys[0].id, base64.StdEncoding.EncodeToString(ciphertext))
+		return
+	}
 	output = fmt.Sprintf("{%s/%s/%s}%s", EncryptAes, mode, padding, base64.StdEncoding.EncodeToString(ciphertext))
 	return
 }
@@ -227,6 +680,12 @@ func IsEncrypted(input string) (encrypted bool) {
 }
 
 func GetCiphertext(input string) (ciphertext string, mode cipher.Mode, padding cipher.Padding, err error) {
+	ciphertext, _, mode, padding, err = ParseCiphertext(input)
+	return
+}
+
+// ParseCiphertext is GetCiphertext which also returns the key id of the input, empty if it has none.
+func ParseCiphertext(input string) (ciphertext string, keyId string, mode cipher.Mode, padding cipher.Padding, err error) {
 	list := strings.SplitN(input, "}", 2)
 	if len(list) != 2 {
 		err = fmt.Errorf("invalid input for GetCiphertext: %v", input)
@@ -234,10 +693,13 @@ func GetCiphertext(input string) (ciphertext string, mode cipher.Mode, padding c
 	}
 	ciphertext = list[1]
 	list = strings.Split(strings.TrimLeft(list[0], "{"), "/")
-	if len(list) != 3 {
+	if len(list) != 3 && len(list) != 4 {
 		err = fmt.Errorf("invalid input for GetCiphertext: %v", input)
 		return
 	}
+	if len(list) == 4 {
+		keyId = list[3]
+	}
 	// encryption algorithm
 	if list[0] != EncryptAes {
 		err = fmt.Errorf("unsupported algorithm for GetCiphertext: %v", list[0])
@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"bytes"
+	gocipher "crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/apid/apid-core/cipher"
+	"io"
+)
+
+/*
+ * Besides ECB from apid-core, AES is supported in the modes:
+ *   GCM with NoPadding, the payload being the 12 bytes nonce followed by the sealed ciphertext and tag
+ *   CBC with PKCS5Padding, the payload being the 16 bytes IV followed by the ciphertext
+ * A new nonce or IV is generated for each value.
+ */
+const (
+	ModeGcm cipher.Mode = "GCM"
+	ModeCbc cipher.Mode = "CBC"
+
+	PaddingNone cipher.Padding = "NoPadding"
+)
+
+var errInvalidPadding = errors.New("invalid padding")
+
+// isAuthenticated returns whether the mode detects tampered or wrongly keyed ciphertexts
+func isAuthenticated(mode cipher.Mode) bool {
+	return mode == ModeGcm
+}
+
+// defaultPadding returns the padding used with the mode when none is given
+func defaultPadding(mode cipher.Mode) cipher.Padding {
+	if mode == ModeGcm {
+		return PaddingNone
+	}
+	return cipher.PaddingPKCS5
+}
+
+// validateMode returns an error if the mode and padding are not supported together
+func validateMode(mode cipher.Mode, padding cipher.Padding) error {
+	switch {
+	case mode == ModeGcm && padding == PaddingNone,
+		mode == ModeCbc && padding == cipher.PaddingPKCS5,
+		mode == cipher.ModeEcb && padding == cipher.PaddingPKCS5:
+		return nil
+	}
+	return fmt.Errorf("unsupported mode/padding %v/%v", mode, padding)
+}
+
+func (k *orgKey) encrypt(plaintext []byte, mode cipher.Mode, padding cipher.Padding) ([]byte, error) {
+	if err := validateMode(mode, padding); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case ModeGcm:
+		nonce := make([]byte, k.gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		return k.gcm.Seal(nonce, nonce, plaintext, nil), nil
+	case ModeCbc:
+		blockSize := k.block.BlockSize()
+		padded := pkcs5Pad(plaintext, blockSize)
+		ciphertext := make([]byte, blockSize+len(padded))
+		iv := ciphertext[:blockSize]
+		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			return nil, err
+		}
+		gocipher.NewCBCEncrypter(k.block, iv).CryptBlocks(ciphertext[blockSize:], padded)
+		return ciphertext, nil
+	}
+	return k.aes.Encrypt(plaintext, mode, padding)
+}
+
+func (k *orgKey) decrypt(ciphertext []byte, mode cipher.Mode, padding cipher.Padding) ([]byte, error) {
+	if err := validateMode(mode, padding); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case ModeGcm:
+		nonceSize := k.gcm.NonceSize()
+		if len(ciphertext) < nonceSize+k.gcm.Overhead() {
+			return nil, errors.New("ciphertext too short")
+		}
+		return k.gcm.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	case ModeCbc:
+		blockSize := k.block.BlockSize()
+		if len(ciphertext) < 2*blockSize || len(ciphertext)%blockSize != 0 {
+			return nil, errors.New("ciphertext is not a whole number of blocks after the IV")
+		}
+		plaintext := make([]byte, len(ciphertext)-blockSize)
+		gocipher.NewCBCDecrypter(k.block, ciphertext[:blockSize]).CryptBlocks(plaintext, ciphertext[blockSize:])
+		return pkcs5Unpad(plaintext, blockSize)
+	}
+	return k.aes.Decrypt(ciphertext, mode, padding)
+}
+
+func pkcs5Pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	return append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs5Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errInvalidPadding
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, errInvalidPadding
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, errInvalidPadding
+		}
+	}
+	return data[:len(data)-n], nil
+}
@@ -14,15 +14,20 @@
 package common
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/apid/apid-core/cipher"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"time"
 )
 
@@ -42,9 +47,7 @@ var _ = Describe("Cipher Test", func() {
 		BeforeEach(func() {
 			testCipherMan = CreateCipherManager(nil, "")
 			// set key locally
-			var err error
-			testCipherMan.aes[testOrg], err = cipher.CreateAesCipher(key)
-			Expect(err).Should(Succeed())
+			Expect(testCipherMan.setKey(testOrg, "", key)).Should(Succeed())
 		})
 
 		It("Encryption", func() {
@@ -59,6 +62,13 @@ var _ = Describe("Cipher Test", func() {
 		It("Try to decrypt unencrypted input", func() {
 			Expect(testCipherMan.TryDecryptBase64(plaingtext, testOrg)).Should(Equal(plaingtext))
 		})
+
+		It("Remove orgs", func() {
+			testCipherMan.RemoveOrgs([]string{testOrg, "non-existent"})
+			testCipherMan.mutex.RLock()
+			defer testCipherMan.mutex.RUnlock()
+			Expect(testCipherMan.keys[testOrg]).Should(BeEmpty())
+		})
 	})
 
 	Context("Retrieve new key", func() {
@@ -113,7 +123,7 @@ var _ = Describe("Cipher Test", func() {
 				for {
 					time.Sleep(100 * time.Millisecond)
 					testCipherMan.mutex.RLock()
-					l := len(testCipherMan.aes)
+					l := len(testCipherMan.keys)
 					testCipherMan.mutex.RUnlock()
 					if l == 2 {
 						//close server to make sure key was retrieved by "AddOrgs"
@@ -153,9 +163,9 @@ var _ = Describe("Cipher Test", func() {
 				for {
 					time.Sleep(100 * time.Millisecond)
 					testCipherMan.mutex.RLock()
-					aes := testCipherMan.aes[testOrg]
+					keys := testCipherMan.keys[testOrg]
 					testCipherMan.mutex.RUnlock()
-					if aes != nil {
+					if len(keys) > 0 {
 						//close server to make sure key was retrieved by "AddOrgs"
 						server.Close()
 						Expect(testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)).
@@ -184,8 +194,15 @@ var _ = Describe("Cipher Test", func() {
 				}))
 				time.Sleep(100 * time.Millisecond)
 				testCipherMan = CreateCipherManager(&http.Client{}, server.URL)
+				testCipherMan.interval = 10 * time.Millisecond
 				//should stop retrying after one try
-				testCipherMan.startRetrieve(testOrg, 100*time.Millisecond, 10*time.Minute)
+				testCipherMan.AddOrgs([]string{testOrg})
+				Eventually(func() bool {
+					testCipherMan.mutex.RLock()
+					defer testCipherMan.mutex.RUnlock()
+					return testCipherMan.retrieving[testOrg]
+				}).Should(BeFalse())
+				Expect(testCipherMan.Stats().NoKeyOrgs).Should(Equal(1))
 			}, 2)
 
 			It("Retrieve Key should stop retrying for XML organizations.EncryptionKeyDoesNotExist", func() {
@@ -207,13 +224,454 @@ var _ = Describe("Cipher Test", func() {
 				}))
 				time.Sleep(100 * time.Millisecond)
 				testCipherMan = CreateCipherManager(&http.Client{}, server.URL)
+				testCipherMan.interval = 10 * time.Millisecond
 				//should stop retrying after one try
-				testCipherMan.startRetrieve(testOrg, 100*time.Millisecond, 10*time.Minute)
+				testCipherMan.AddOrgs([]string{testOrg})
+				Eventually(func() bool {
+					testCipherMan.mutex.RLock()
+					defer testCipherMan.mutex.RUnlock()
+					return testCipherMan.retrieving[testOrg]
+				}).Should(BeFalse())
+				Expect(testCipherMan.Stats().NoKeyOrgs).Should(Equal(1))
 			}, 2)
 		})
 
 	})
 
+	Context("Modes", func() {
+		BeforeEach(func() {
+			testCipherMan = CreateCipherManager(nil, "")
+			Expect(testCipherMan.setKey(testOrg, "", key)).Should(Succeed())
+		})
+
+		It("should encrypt and decrypt with a new IV per value", func() {
+			for _, mode := range []cipher.Mode{ModeGcm, ModeCbc} {
+				encrypted, err := testCipherMan.EncryptBase64(plaingtext, testOrg, mode, defaultPadding(mode))
+				Expect(err).Should(Succeed())
+				Expect(encrypted).Should(HavePrefix(fmt.Sprintf("{AES/%s/%s}", mode, defaultPadding(mode))))
+				Expect(testCipherMan.TryDecryptBase64(encrypted, testOrg)).Should(Equal(plaingtext))
+
+				again, err := testCipherMan.EncryptBase64(plaingtext, testOrg, mode, defaultPadding(mode))
+				Expect(err).Should(Succeed())
+				Expect(again).ShouldNot(Equal(encrypted))
+			}
+		})
+
+		It("should use the default mode", func() {
+			encrypted, err := testCipherMan.EncryptBase64(plaingtext, testOrg, "", "")
+			Expect(err).Should(Succeed())
+			Expect(encrypted).Should(HavePrefix("{AES/GCM/NoPadding}"))
+
+			Expect(testCipherMan.SetEncryptionMode(ModeCbc, false)).Should(Succeed())
+			encrypted, err = testCipherMan.EncryptBase64(plaingtext, testOrg, "", "")
+			Expect(err).Should(Succeed())
+			Expect(encrypted).Should(HavePrefix("{AES/CBC/PKCS5Padding}"))
+		})
+
+		It("should reject tampered GCM ciphertexts", func() {
+			encrypted, err := testCipherMan.EncryptBase64(plaingtext, testOrg, ModeGcm, PaddingNone)
+			Expect(err).Should(Succeed())
+			text, _, _, _, err := ParseCiphertext(encrypted)
+			Expect(err).Should(Succeed())
+			bytes, err := base64.StdEncoding.DecodeString(text)
+			Expect(err).Should(Succeed())
+			bytes[len(bytes)-1] ^= 1
+			_, err = testCipherMan.TryDecryptBase64("{AES/GCM/NoPadding}"+base64.StdEncoding.EncodeToString(bytes), testOrg)
+			Expect(err).ShouldNot(Succeed())
+			_, err = testCipherMan.TryDecryptBase64("{AES/GCM/NoPadding}AAAA", testOrg)
+			Expect(err).ShouldNot(Succeed())
+		})
+
+		It("should reject unsupported modes and paddings", func() {
+			_, err := testCipherMan.EncryptBase64(plaingtext, testOrg, ModeGcm, cipher.PaddingPKCS5)
+			Expect(err).ShouldNot(Succeed())
+			_, err = testCipherMan.EncryptBase64(plaingtext, testOrg, "CTR", PaddingNone)
+			Expect(err).ShouldNot(Succeed())
+			_, err = testCipherMan.TryDecryptBase64("{AES/CBC/NoPadding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=", testOrg)
+			Expect(err).ShouldNot(Succeed())
+			Expect(testCipherMan.SetEncryptionMode("CTR", false)).ShouldNot(Succeed())
+		})
+
+		It("should only encrypt with authenticated modes in strict mode", func() {
+			Expect(testCipherMan.SetEncryptionMode(cipher.ModeEcb, true)).ShouldNot(Succeed())
+			Expect(testCipherMan.SetEncryptionMode(ModeGcm, true)).Should(Succeed())
+			for _, mode := range []cipher.Mode{cipher.ModeEcb, ModeCbc} {
+				_, err := testCipherMan.EncryptBase64(plaingtext, testOrg, mode, cipher.PaddingPKCS5)
+				Expect(err).ShouldNot(Succeed())
+			}
+			_, err := testCipherMan.EncryptBase64(plaingtext, testOrg, ModeGcm, PaddingNone)
+			Expect(err).Should(Succeed())
+			// existing values can still be decrypted
+			Expect(testCipherMan.TryDecryptBase64(cipher64, testOrg)).Should(Equal(plaingtext))
+		})
+
+		It("should check the whole PKCS5 padding", func() {
+			Expect(pkcs5Unpad([]byte{1, 2, 3, 3, 3}, 16)).Should(Equal([]byte{1, 2}))
+			for _, data := range [][]byte{{}, {1, 2, 3, 2, 3}, {1, 0}, {1, 17}, {2}} {
+				_, err := pkcs5Unpad(data, 16)
+				Expect(err).Should(Equal(errInvalidPadding))
+			}
+		})
+	})
+
+	Context("Key rotation", func() {
+		key2 := []byte{137, 9, 66, 201, 18, 240, 75, 3, 56, 114, 222, 90, 17, 163, 8, 45}
+		key3 := []byte{61, 180, 27, 99, 204, 12, 143, 250, 6, 77, 118, 39, 191, 84, 230, 5}
+		key4 := []byte{93, 14, 171, 236, 40, 125, 68, 157, 222, 3, 88, 209, 31, 146, 74, 19}
+
+		BeforeEach(func() {
+			testCipherMan = CreateCipherManager(nil, "")
+		})
+
+		It("should decrypt with previous keys", func() {
+			Expect(testCipherMan.setKey(testOrg, "", key)).Should(Succeed())
+			Expect(testCipherMan.setKey(testOrg, "", key2)).Should(Succeed())
+			encrypted, err := testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)
+			Expect(err).Should(Succeed())
+			Expect(encrypted).ShouldNot(Equal(cipher64))
+
+			Expect(testCipherMan.TryDecryptBase64(encrypted, testOrg)).Should(Equal(plaingtext))
+			Expect(testCipherMan.TryDecryptBase64(cipher64, testOrg)).Should(Equal(plaingtext))
+		})
+
+		It("should only keep the latest keys", func() {
+			for _, k := range [][]byte{key, key2, key3, key2, key4} {
+				Expect(testCipherMan.setKey(testOrg, "", k)).Should(Succeed())
+			}
+			keys := testCipherMan.keys[testOrg]
+			Expect(keys).Should(HaveLen(maxOrgKeys))
+			Expect(keys[0].id).Should(Equal(fingerprint(key4)))
+			Expect(keys[1].id).Should(Equal(fingerprint(key2)))
+			Expect(keys[2].id).Should(Equal(fingerprint(key3)))
+		})
+
+		It("should encrypt and decrypt with key ids", func() {
+			Expect(testCipherMan.setKey(testOrg, "k1", key)).Should(Succeed())
+			Expect(testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)).
+				Should(Equal("{AES/ECB/PKCS5Padding/k1}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4="))
+			Expect(testCipherMan.setKey(testOrg, "k2", key2)).Should(Succeed())
+			Expect(testCipherMan.TryDecryptBase64("{AES/ECB/PKCS5Padding/k1}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=", testOrg)).
+				Should(Equal(plaingtext))
+		})
+
+		Context("KMS", func() {
+			var server *httptest.Server
+			var current []byte
+			var currentId string
+			var requests int
+			var mutex sync.Mutex
+
+			BeforeEach(func() {
+				mutex.Lock()
+				current, currentId, requests = key, "k1", 0
+				mutex.Unlock()
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.URL.Path).Should(Equal(retrieveEncryptKeyPath))
+					mutex.Lock()
+					defer mutex.Unlock()
+					requests++
+					bytes, err := json.Marshal(kmsKeyResponse{Id: currentId, Key: base64.StdEncoding.EncodeToString(current)})
+					Expect(err).Should(Succeed())
+					w.Header().Set(headerContentType, typeJson)
+					Expect(w.Write(bytes)).Should(Equal(len(bytes)))
+				}))
+				testCipherMan = CreateCipherManager(&http.Client{}, server.URL)
+			})
+
+			AfterEach(func() {
+				testCipherMan.StopKeyRefresh()
+				server.Close()
+			})
+
+			It("should retrieve an unknown key id", func() {
+				Expect(testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)).
+					Should(HavePrefix("{AES/ECB/PKCS5Padding/k1}"))
+				mutex.Lock()
+				current, currentId = key2, "k2"
+				mutex.Unlock()
+				encrypted := "{AES/ECB/PKCS5Padding/k2}" + base64.StdEncoding.EncodeToString(encryptWith(key2, plaingtext))
+				Expect(testCipherMan.TryDecryptBase64(encrypted, testOrg)).Should(Equal(plaingtext))
+				_, err := testCipherMan.TryDecryptBase64("{AES/ECB/PKCS5Padding/k3}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=", testOrg)
+				Expect(err).ShouldNot(Succeed())
+			})
+
+			It("should not retrieve an id unknown to KMS until the TTL has passed", func() {
+				getRequests := func() int {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return requests
+				}
+				stale := "{AES/ECB/PKCS5Padding/k3}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4="
+				for i := 0; i < 3; i++ {
+					_, err := testCipherMan.TryDecryptBase64(stale, testOrg)
+					Expect(err).ShouldNot(Succeed())
+				}
+				// the first retrieval of the org, then the one of the unknown id
+				Expect(getRequests()).Should(Equal(2))
+
+				testCipherMan.mutex.Lock()
+				testCipherMan.unknownIds[testOrg]["k3"] = time.Now()
+				testCipherMan.mutex.Unlock()
+				mutex.Lock()
+				current, currentId = key, "k3"
+				mutex.Unlock()
+				Expect(testCipherMan.TryDecryptBase64(stale, testOrg)).Should(Equal(plaingtext))
+				Expect(getRequests()).Should(Equal(3))
+				testCipherMan.mutex.RLock()
+				Expect(testCipherMan.unknownIds[testOrg]).ShouldNot(HaveKey("k3"))
+				testCipherMan.mutex.RUnlock()
+			})
+
+			It("should refresh keys periodically", func() {
+				testCipherMan.AddOrgs([]string{testOrg})
+				Eventually(func() int {
+					testCipherMan.mutex.RLock()
+					defer testCipherMan.mutex.RUnlock()
+					return len(testCipherMan.keys[testOrg])
+				}).Should(Equal(1))
+
+				testCipherMan.StartKeyRefresh(50 * time.Millisecond)
+				mutex.Lock()
+				current, currentId = key2, "k2"
+				mutex.Unlock()
+				Eventually(func() []string {
+					testCipherMan.mutex.RLock()
+					defer testCipherMan.mutex.RUnlock()
+					var ids []string
+					for _, k := range testCipherMan.keys[testOrg] {
+						ids = append(ids, k.id)
+					}
+					return ids
+				}, time.Second).Should(Equal([]string{"k2", "k1"}))
+			})
+		})
+	})
+
+	Context("Key server failures", func() {
+		var server *httptest.Server
+		var requests int
+		var handler func(w http.ResponseWriter)
+		var mutex sync.Mutex
+
+		BeforeEach(func() {
+			mutex.Lock()
+			requests = 0
+			mutex.Unlock()
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				mutex.Lock()
+				requests++
+				mutex.Unlock()
+				handler(w)
+			}))
+			testCipherMan = CreateCipherManager(&http.Client{}, server.URL)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		getRequests := func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return requests
+		}
+
+		It("should not retrieve the key of an org without key until the TTL has passed", func() {
+			handler = func(w http.ResponseWriter) {
+				bytes, err := json.Marshal(KeyErrorResponse{Code: errorCodeNoKey})
+				Expect(err).Should(Succeed())
+				w.Header().Set(headerContentType, typeJson)
+				w.WriteHeader(http.StatusNotFound)
+				w.Write(bytes)
+			}
+			for i := 0; i < 3; i++ {
+				Expect(testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)).
+					Should(Equal(plaingtext))
+			}
+			Expect(getRequests()).Should(Equal(1))
+			Expect(testCipherMan.Stats().NoKeyOrgs).Should(Equal(1))
+
+			testCipherMan.mutex.Lock()
+			testCipherMan.noKey[testOrg] = time.Now()
+			testCipherMan.mutex.Unlock()
+			handler = func(w http.ResponseWriter) {
+				w.Write([]byte(base64.StdEncoding.EncodeToString(key)))
+			}
+			Expect(testCipherMan.EncryptBase64(plaingtext, testOrg, cipher.ModeEcb, cipher.PaddingPKCS5)).
+				Should(Equal(cipher64))
+			Expect(getRequests()).Should(Equal(2))
+			Expect(testCipherMan.Stats().NoKeyOrgs).Should(BeZero())
+		})
+
+		It("should share concurrent retrievals of the same org", func() {
+			release := make(chan struct{})
+			handler = func(w http.ResponseWriter) {
+				<-release
+				w.Write([]byte(base64.StdEncoding.EncodeToString(key)))
+			}
+			results := make(chan string)
+			for i := 0; i < 5; i++ {
+				go func() {
+					defer GinkgoRecover()
+					output, err := testCipherMan.TryDecryptBase64(cipher64, testOrg)
+					Expect(err).Should(Succeed())
+					results <- output
+				}()
+			}
+			Eventually(func() uint64 {
+				return testCipherMan.Stats().SharedFetches
+			}).Should(Equal(uint64(4)))
+			close(release)
+			for i := 0; i < 5; i++ {
+				Eventually(results).Should(Receive(Equal(plaingtext)))
+			}
+			Expect(getRequests()).Should(Equal(1))
+		})
+
+		It("should stop calling a failing key server", func() {
+			handler = func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			for i := 0; i < keyServerFailureThreshold+2; i++ {
+				_, err := testCipherMan.TryDecryptBase64(cipher64, testOrg)
+				Expect(err).ShouldNot(Succeed())
+			}
+			Expect(getRequests()).Should(Equal(keyServerFailureThreshold))
+			Expect(testCipherMan.Stats().KeyServerState).Should(Equal(BreakerOpen))
+
+			// a failed trial call opens the circuit again
+			testCipherMan.breaker.cooldown = 0
+			_, err := testCipherMan.TryDecryptBase64(cipher64, testOrg)
+			Expect(err).ShouldNot(Succeed())
+			Expect(getRequests()).Should(Equal(keyServerFailureThreshold + 1))
+			Expect(testCipherMan.Stats().KeyServerState).Should(Equal(BreakerOpen))
+
+			handler = func(w http.ResponseWriter) {
+				w.Write([]byte(base64.StdEncoding.EncodeToString(key)))
+			}
+			Expect(testCipherMan.TryDecryptBase64(cipher64, testOrg)).Should(Equal(plaingtext))
+			Expect(testCipherMan.Stats()).Should(Equal(KmsCipherStats{KeyServerState: BreakerClosed}))
+		})
+
+		It("should not queue orgs already retrieving or retrieved", func() {
+			release := make(chan struct{})
+			handler = func(w http.ResponseWriter) {
+				<-release
+				w.Write([]byte(base64.StdEncoding.EncodeToString(key)))
+			}
+			testCipherMan.AddOrgs([]string{testOrg})
+			testCipherMan.AddOrgs([]string{testOrg})
+			Eventually(getRequests).Should(Equal(1))
+			close(release)
+			Eventually(func() int {
+				testCipherMan.mutex.RLock()
+				defer testCipherMan.mutex.RUnlock()
+				return len(testCipherMan.keys[testOrg])
+			}).Should(Equal(1))
+			testCipherMan.AddOrgs([]string{testOrg})
+			Consistently(getRequests, 200*time.Millisecond).Should(Equal(1))
+		})
+
+		It("should cancel retrievals when closed", func() {
+			release := make(chan struct{})
+			defer close(release)
+			handler = func(w http.ResponseWriter) {
+				<-release
+			}
+			orgs := make([]string, maxRetrieveWorkers+2)
+			for i := range orgs {
+				orgs[i] = fmt.Sprintf("%s_%d", testOrg, i)
+			}
+			testCipherMan.AddOrgs(orgs)
+			// queued orgs wait for a free worker
+			Eventually(getRequests).Should(Equal(maxRetrieveWorkers))
+			Consistently(getRequests, 100*time.Millisecond).Should(Equal(maxRetrieveWorkers))
+
+			testCipherMan.Close()
+			Eventually(func() int {
+				testCipherMan.mutex.RLock()
+				defer testCipherMan.mutex.RUnlock()
+				return len(testCipherMan.retrieving)
+			}).Should(BeZero())
+			testCipherMan.AddOrgs([]string{testOrg})
+			Consistently(getRequests, 100*time.Millisecond).Should(Equal(maxRetrieveWorkers))
+		})
+
+		It("should back off exponentially with jitter", func() {
+			for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+				for i := 0; i < 20; i++ {
+					d := retrieveBackoff(attempt, time.Second, 8*time.Second)
+					Expect(d).Should(BeNumerically(">=", max/2))
+					Expect(d).Should(BeNumerically("<=", max))
+				}
+			}
+		})
+
+		It("should allow a single trial call when half-open", func() {
+			breaker := createKeyServerBreaker(1, time.Minute)
+			now := time.Now()
+			Expect(breaker.allow(now)).Should(BeTrue())
+			breaker.record(false, now)
+			Expect(breaker.allow(now.Add(time.Second))).Should(BeFalse())
+			Expect(breaker.allow(now.Add(time.Minute))).Should(BeTrue())
+			Expect(breaker.allow(now.Add(time.Minute))).Should(BeFalse())
+			breaker.record(true, now.Add(time.Minute))
+			Expect(breaker.allow(now.Add(time.Minute))).Should(BeTrue())
+		})
+	})
+
+	Context("Key statuses", func() {
+		It("should report the state of each org without the keys", func() {
+			source := &fakeKeySource{
+				keys: map[string]*EncryptionKey{"loaded": {Id: "k1", Key: key}},
+				errs: map[string]error{"absent": ErrNoKey, "failing": errors.New("connection refused")},
+			}
+			testCipherMan = CreateCipherManagerWithSource(source)
+			testCipherMan.timeout = 0
+			testCipherMan.AddOrgs([]string{"loaded", "absent", "failing"})
+			Eventually(func() int {
+				testCipherMan.mutex.RLock()
+				defer testCipherMan.mutex.RUnlock()
+				return len(testCipherMan.retrieving)
+			}).Should(BeZero())
+			testCipherMan.mutex.Lock()
+			testCipherMan.orgs["pending"] = true
+			testCipherMan.mutex.Unlock()
+
+			statuses := testCipherMan.KeyStatuses()
+			Expect(statuses).Should(HaveLen(4))
+			Expect(statuses[0].Org).Should(Equal("absent"))
+			Expect(statuses[0].State).Should(Equal(KeyStateAbsent))
+			Expect(statuses[1].Org).Should(Equal("failing"))
+			Expect(statuses[1].State).Should(Equal(KeyStateFailing))
+			Expect(statuses[1].LastError).Should(Equal("connection refused"))
+			Expect(statuses[1].LastFetch.IsZero()).Should(BeTrue())
+			Expect(statuses[2].Org).Should(Equal("loaded"))
+			Expect(statuses[2].State).Should(Equal(KeyStateLoaded))
+			Expect(statuses[2].KeyId).Should(Equal("k1"))
+			Expect(statuses[2].Fingerprint).Should(Equal(fingerprint(key)))
+			Expect(statuses[2].Keys).Should(Equal(1))
+			Expect(statuses[2].LastFetch.IsZero()).Should(BeFalse())
+			Expect(statuses[3]).Should(Equal(KeyStatus{Org: "pending", State: KeyStatePending}))
+
+			// an org without key stays absent once it may be retrieved again
+			testCipherMan.mutex.Lock()
+			testCipherMan.noKey["absent"] = time.Now()
+			testCipherMan.mutex.Unlock()
+			Expect(testCipherMan.KeyStatuses()[0].State).Should(Equal(KeyStateAbsent))
+
+			testCipherMan.mutex.Lock()
+			testCipherMan.retrieving["failing"] = true
+			testCipherMan.mutex.Unlock()
+			Expect(testCipherMan.KeyStatuses()[1].State).Should(Equal(KeyStateRetrying))
+
+			testCipherMan.RemoveOrgs([]string{"failing"})
+			Expect(testCipherMan.KeyStatuses()).Should(HaveLen(3))
+		})
+	})
+
 	Context("IsEncrypted", func() {
 		It("IsEncrypted", func() {
 			testData := [][]interface{}{
@@ -223,11 +681,50 @@ var _ = Describe("Cipher Test", func() {
 				{"{AES/ECB/}foo", false},
 				{"{AES/PKCS5Padding}foo", false},
 				{"{AES//PKCS5Padding}foo", false},
+				{"{AES/ECB/PKCS5Padding/k-1.2}foo", true},
+				{"{AES/ECB/PKCS5Padding/}foo", false},
 				{"foo", false},
 			}
 			for i := range testData {
 				Expect(IsEncrypted(testData[i][0].(string))).Should(Equal(testData[i][1]))
 			}
 		})
+
+		It("ParseCiphertext", func() {
+			text, keyId, mode, padding, err := ParseCiphertext("{AES/ECB/PKCS5Padding/k1}foo")
+			Expect(err).Should(Succeed())
+			Expect([]interface{}{text, keyId, mode, padding}).Should(Equal([]interface{}{"foo", "k1", cipher.ModeEcb, cipher.PaddingPKCS5}))
+			_, keyId, _, _, err = ParseCiphertext(cipher64)
+			Expect(err).Should(Succeed())
+			Expect(keyId).Should(BeEmpty())
+		})
 	})
 })
+
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func encryptWith(key []byte, plaintext string) []byte {
+	a, err := cipher.CreateAesCipher(key)
+	Expect(err).Should(Succeed())
+	ciphertext, err := a.Encrypt([]byte(plaintext), cipher.ModeEcb, cipher.PaddingPKCS5)
+	Expect(err).Should(Succeed())
+	return ciphertext
+}
+
+type fakeKeySource struct {
+	keys map[string]*EncryptionKey
+	errs map[string]error
+}
+
+func (s *fakeKeySource) GetKey(_ context.Context, org string) (*EncryptionKey, error) {
+	if err := s.errs[org]; err != nil {
+		return nil, err
+	}
+	if key := s.keys[org]; key != nil {
+		return key, nil
+	}
+	return nil, ErrNoKey
+}
@@ -16,7 +16,9 @@ package common
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/apid/apid-core"
+	tran "github.com/apigee-labs/transicator/common"
 	"strings"
 	"sync"
 	"unicode/utf8"
@@ -27,13 +29,20 @@ type DbManager struct {
 	Db            apid.DB
 	DbMux         sync.RWMutex
 	CipherManager CipherManagerInterface
-	dbVersion     string
+	// optional, nil disables caching of compiled resources
+	ResourceMatcher *ResourceMatcher
+	dbVersion       string
+	// optional, if set all reads use its DB instead of the current one
+	Pin *DbPin
 }
 
 const (
-	sql_GET_KMS_ATTRIBUTES_FOR_TENANT = `select entity_id, name, value from kms_attributes where tenant_id = $1`
+	sql_GET_KMS_ATTRIBUTES_FOR_TENANT = `select entity_id, name, value from kms_attributes where tenant_id = ?`
 )
 
+// max number of entity ids bound in a single query, below the SQLite limit of 999 parameters
+const maxQueryEntities = 500
+
 var (
 	services apid.Services
 	log      apid.LogService
@@ -49,34 +58,83 @@ func (dbc *DbManager) SetDbVersion(version string) {
 	if err != nil {
 		log.Panicf("Unable to access database: %v", err)
 	}
+	acquireDbVersion(version)
 	dbc.DbMux.Lock()
 	dbc.Db = db
-	dbc.DbMux.Unlock()
+	oldVersion := dbc.dbVersion
 	dbc.dbVersion = version
+	dbc.DbMux.Unlock()
+	// the old version is released once the requests pinning it are done
+	releaseDbVersion(dbc.Data, oldVersion)
 }
 
 func (dbc *DbManager) GetDb() apid.DB {
+	if dbc.Pin != nil {
+		return dbc.Pin.Db
+	}
 	dbc.DbMux.RLock()
 	defer dbc.DbMux.RUnlock()
 	return dbc.Db
 }
 
 func (dbc *DbManager) GetDbVersion() string {
+	if dbc.Pin != nil {
+		return dbc.Pin.Version
+	}
+	dbc.DbMux.RLock()
+	defer dbc.DbMux.RUnlock()
 	return dbc.dbVersion
 }
 
-func (dbc *DbManager) GetKmsAttributes(tenantId string, entities ...string) map[string][]Attribute {
+// GetDbAndVersion returns the current DB handle together with its version.
+func (dbc *DbManager) GetDbAndVersion() (apid.DB, string) {
+	if dbc.Pin != nil {
+		return dbc.Pin.Db, dbc.Pin.Version
+	}
+	dbc.DbMux.RLock()
+	defer dbc.DbMux.RUnlock()
+	return dbc.Db, dbc.dbVersion
+}
 
-	db := dbc.Db
-	var attName, attValue, entity_id sql.NullString
-	sql := sql_GET_KMS_ATTRIBUTES_FOR_TENANT + ` and entity_id in ('` + strings.Join(entities, `','`) + `')`
+// No data is cached at this level, so there is nothing to invalidate.
+func (dbc *DbManager) InvalidateCache(changes []tran.Change) {
+}
+
+func (dbc *DbManager) GetKmsAttributes(tenantId string, entities ...string) (map[string][]Attribute, error) {
+	return QueryKmsAttributes(dbc.GetDb(), tenantId, entities...)
+}
+
+/*
+ * QueryKmsAttributes gets the attributes of the given entities from a specific DB handle.
+ * The entity ids are bound as query parameters, in chunks of at most maxQueryEntities.
+ */
+func QueryKmsAttributes(db apid.DB, tenantId string, entities ...string) (map[string][]Attribute, error) {
 	mapOfAttributes := make(map[string][]Attribute)
-	attributes, err := db.Query(sql, tenantId)
-	defer attributes.Close()
+	for start := 0; start < len(entities); start += maxQueryEntities {
+		end := start + maxQueryEntities
+		if end > len(entities) {
+			end = len(entities)
+		}
+		if err := queryKmsAttributes(db, tenantId, entities[start:end], mapOfAttributes); err != nil {
+			return nil, err
+		}
+	}
+	return mapOfAttributes, nil
+}
+
+func queryKmsAttributes(db apid.DB, tenantId string, entities []string, mapOfAttributes map[string][]Attribute) error {
+	var attName, attValue, entity_id sql.NullString
+	query := sql_GET_KMS_ATTRIBUTES_FOR_TENANT + ` and entity_id in (` + placeholders(len(entities)) + `)`
+	args := make([]interface{}, 0, len(entities)+1)
+	args = append(args, tenantId)
+	for _, entity := range entities {
+		args = append(args, entity)
+	}
+	attributes, err := db.Query(query, args...)
 	if err != nil {
-		log.Error("Error while fetching attributes for tenant id : %s and entityId : %s", tenantId, err)
-		return mapOfAttributes
+		return fmt.Errorf("error fetching attributes for tenant id %s: %v", tenantId, err)
 	}
+	defer attributes.Close()
 	for attributes.Next() {
 		err := attributes.Scan(
 			&entity_id,
@@ -84,8 +142,7 @@ func (dbc *DbManager) GetKmsAttributes(tenantId string, entities ...string) map[
 			&attValue,
 		)
 		if err != nil {
-			log.Error("error fetching attributes for entityid ", entities, err)
-			return nil
+			return fmt.Errorf("error scanning attributes for tenant id %s: %v", tenantId, err)
 		}
 		if attName.Valid && entity_id.Valid {
 			att := Attribute{Name: attName.String, Value: attValue.String}
@@ -94,7 +151,36 @@ func (dbc *DbManager) GetKmsAttributes(tenantId string, entities ...string) map[
 			log.Debugf("Not valid. AttName: %s Entity_id: %s", attName.String, entity_id.String)
 		}
 	}
-	return mapOfAttributes
+	return attributes.Err()
+}
+
+/*
+ * QueryChunks calls query with consecutive chunks of at most maxQueryEntities ids, as query arguments,
+ * and the placeholders binding them, so that the ids of a query never exceed the parameters the DB accepts.
+ */
+func QueryChunks(ids []string, query func(args []interface{}, placeholders string) error) error {
+	for start := 0; start < len(ids); start += maxQueryEntities {
+		end := start + maxQueryEntities
+		if end > len(ids) {
+			end = len(ids)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		if err := query(args, placeholders(len(args))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholders returns n comma separated query parameters
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
 }
 
 func (dbc *DbManager) GetOrgs() (orgs []string, err error) {
@@ -155,6 +241,11 @@ func AddIndexes(version string) error {
 	return err
 }
 
+// Changelists name tables as "schema.table", while snapshots use "schema_table".
+func NormalizeTableName(table string) string {
+	return strings.ToLower(strings.Replace(table, ".", "_", 1))
+}
+
 func JsonToStringArray(fjson string) []string {
 	var array []string
 	if err := json.Unmarshal([]byte(fjson), &array); err == nil {
@@ -23,6 +23,8 @@ type ErrorResponse struct {
 	ResponseMessage string `json:"response_message,omitempty"`
 	StatusCode      int    `json:"-"`
 	Kind            string `json:"kind,omitempty"`
+	// optional diagnostics of the error
+	Details interface{} `json:"details,omitempty"`
 }
 
 func (e *ErrorResponse) Error() string {
@@ -85,6 +87,13 @@ type AppCredential struct {
 	UpdatedBy      string `db:"updated_by"`
 }
 
+// ApiProductReference is the mapping of a consumer key to an apiproduct, named by Name
+type ApiProductReference struct {
+	ConsumerKey string `db:"appcred_id"`
+	Name        string `db:"name"`
+	Status      string `db:"status"`
+}
+
 type Company struct {
 	Id          string `db:"id"`
 	TenantId    string `db:"tenant_id"`
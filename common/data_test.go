@@ -14,6 +14,7 @@
 package common
 
 import (
+	"fmt"
 	"github.com/apid/apid-core"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -46,7 +47,8 @@ var _ = Describe("DataTest", func() {
 		})
 
 		It("should get kms attributes", func() {
-			attributes := testDbMan.GetKmsAttributes("bc811169", "40753e12-a50a-429d-9121-e571eb4e43a9", "85629786-37c5-4e8c-bb45-208f3360d005", "50321842-d6ee-4e92-91b9-37234a7920c1", "test-invalid")
+			attributes, err := testDbMan.GetKmsAttributes("bc811169", "40753e12-a50a-429d-9121-e571eb4e43a9", "85629786-37c5-4e8c-bb45-208f3360d005", "50321842-d6ee-4e92-91b9-37234a7920c1", "test-invalid")
+			Expect(err).Should(Succeed())
 			Expect(len(attributes)).Should(BeEquivalentTo(3))
 			Expect(len(attributes["40753e12-a50a-429d-9121-e571eb4e43a9"])).Should(BeEquivalentTo(1))
 			Expect(len(attributes["85629786-37c5-4e8c-bb45-208f3360d005"])).Should(BeEquivalentTo(2))
@@ -54,6 +56,50 @@ var _ = Describe("DataTest", func() {
 			Expect(len(attributes["test-invalid"])).Should(BeEquivalentTo(0))
 		})
 
+		It("should bind hostile entity ids as parameters", func() {
+			for _, id := range []string{
+				"test-invalid') or ('1'='1",
+				"' OR 1=1 --",
+				"'); DROP TABLE kms_attributes; --",
+				`40753e12-a50a-429d-9121-e571eb4e43a9"`,
+			} {
+				attributes, err := testDbMan.GetKmsAttributes("bc811169", id)
+				Expect(err).Should(Succeed(), id)
+				Expect(attributes).Should(BeEmpty(), id)
+			}
+			attributes, err := testDbMan.GetKmsAttributes("bc811169' or '1'='1", "40753e12-a50a-429d-9121-e571eb4e43a9")
+			Expect(err).Should(Succeed())
+			Expect(attributes).Should(BeEmpty())
+			// the table is intact
+			attributes, err = testDbMan.GetKmsAttributes("bc811169", "40753e12-a50a-429d-9121-e571eb4e43a9")
+			Expect(err).Should(Succeed())
+			Expect(attributes).Should(HaveLen(1))
+		})
+
+		It("should query many entity ids in chunks", func() {
+			ids := []string{"40753e12-a50a-429d-9121-e571eb4e43a9"}
+			for i := 0; i < 2*maxQueryEntities; i++ {
+				ids = append(ids, fmt.Sprintf("test-invalid-%d", i))
+			}
+			ids = append(ids, "85629786-37c5-4e8c-bb45-208f3360d005")
+			attributes, err := testDbMan.GetKmsAttributes("bc811169", ids...)
+			Expect(err).Should(Succeed())
+			Expect(attributes).Should(HaveLen(2))
+
+			attributes, err = testDbMan.GetKmsAttributes("bc811169")
+			Expect(err).Should(Succeed())
+			Expect(attributes).Should(BeEmpty())
+		})
+
+		It("should return query errors", func() {
+			db := testDbMan.GetDb()
+			_, err := db.Exec(`ALTER TABLE kms_attributes RENAME TO kms_attributes_renamed`)
+			Expect(err).Should(Succeed())
+			defer db.Exec(`ALTER TABLE kms_attributes_renamed RENAME TO kms_attributes`)
+			_, err = testDbMan.GetKmsAttributes("bc811169", "40753e12-a50a-429d-9121-e571eb4e43a9")
+			Expect(err).ShouldNot(Succeed())
+		})
+
 		It("Should get all orgs", func() {
 			orgs, err := testDbMan.GetOrgs()
 			Expect(err).Should(Succeed())
@@ -65,6 +111,37 @@ var _ = Describe("DataTest", func() {
 			Expect(AddIndexes(testDbMan.GetDbVersion())).Should(Succeed())
 		})
 
+		It("should release old versions once unpinned", func() {
+			data := &releaseRecordingData{DataService: services.Data()}
+			oldVersion := dataTestTempDir + "_pin_old"
+			newVersion := dataTestTempDir + "_pin_new"
+			dbMan := &DbManager{Data: data}
+			otherDbMan := &DbManager{Data: data}
+			dbMan.SetDbVersion(oldVersion)
+			otherDbMan.SetDbVersion(oldVersion)
+
+			pin := dbMan.PinDb()
+			Expect(pin.Version).Should(Equal(oldVersion))
+			Expect(dbVersionRefCount(oldVersion)).Should(Equal(3))
+
+			dbMan.SetDbVersion(newVersion)
+			otherDbMan.SetDbVersion(newVersion)
+			Expect(dbMan.GetDbVersion()).Should(Equal(newVersion))
+			Expect(data.getReleased()).Should(BeEmpty())
+
+			// reads of a pinned manager stay on the pinned version
+			pinned := &DbManager{Data: data, Pin: pin}
+			Expect(pinned.GetDbVersion()).Should(Equal(oldVersion))
+			pinned.PinDb().Release()
+			Expect(dbVersionRefCount(oldVersion)).Should(Equal(1))
+
+			pin.Release()
+			pin.Release()
+			Expect(data.getReleased()).Should(Equal([]string{oldVersion}))
+			Expect(dbVersionRefCount(oldVersion)).Should(BeZero())
+			Expect(dbVersionRefCount(newVersion)).Should(Equal(2))
+		})
+
 	})
 
 	Context("Validate common.JsonToStringArray", func() {
@@ -104,3 +181,21 @@ func setupTestDb(db apid.DB) {
 	_, err = db.Exec(query)
 	Expect(err).Should(Succeed())
 }
+
+type releaseRecordingData struct {
+	apid.DataService
+	mutex    sync.Mutex
+	released []string
+}
+
+func (d *releaseRecordingData) ReleaseDB(version string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.released = append(d.released, version)
+}
+
+func (d *releaseRecordingData) getReleased() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.released
+}
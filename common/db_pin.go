@@ -0,0 +1,98 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"github.com/apid/apid-core"
+	"sync"
+)
+
+// response header carrying the DB version a request was served from
+const HeaderDbVersion = "X-Apid-Db-Version"
+
+// DbPin is a DB handle and its version, held by a request so that all its queries read the same snapshot.
+// The version is not released before the pin is.
+type DbPin struct {
+	Db      apid.DB
+	Version string
+	data    apid.DataService
+	once    sync.Once
+	// false for pins borrowed from another one, whose release is left to their owner
+	owned bool
+}
+
+// Release lets the version be released once it is no longer current, it may be called more than once.
+func (p *DbPin) Release() {
+	if p == nil || !p.owned {
+		return
+	}
+	p.once.Do(func() {
+		releaseDbVersion(p.data, p.Version)
+	})
+}
+
+/*
+ * References to DB versions, shared by all DbManagers as they switch to the same snapshots:
+ * one for each DbManager using the version as its current one, and one for each pin.
+ * A version is released when its last reference is.
+ */
+var dbVersionRefs = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+func acquireDbVersion(version string) {
+	if version == "" {
+		return
+	}
+	dbVersionRefs.Lock()
+	defer dbVersionRefs.Unlock()
+	dbVersionRefs.counts[version]++
+}
+
+func releaseDbVersion(data apid.DataService, version string) {
+	if version == "" {
+		return
+	}
+	dbVersionRefs.Lock()
+	defer dbVersionRefs.Unlock()
+	if dbVersionRefs.counts[version]--; dbVersionRefs.counts[version] > 0 {
+		return
+	}
+	delete(dbVersionRefs.counts, version)
+	if data != nil {
+		log.Debugf("Releasing DB version %s", version)
+		data.ReleaseDB(version)
+	}
+}
+
+// dbVersionRefCount returns the references to the version
+func dbVersionRefCount(version string) int {
+	dbVersionRefs.Lock()
+	defer dbVersionRefs.Unlock()
+	return dbVersionRefs.counts[version]
+}
+
+// PinDb pins the current DB and version for the duration of a request, the pin must be released.
+func (dbc *DbManager) PinDb() *DbPin {
+	if dbc.Pin != nil {
+		// already pinned, the owner of the pin releases it
+		return &DbPin{Db: dbc.Pin.Db, Version: dbc.Pin.Version}
+	}
+	dbc.DbMux.RLock()
+	defer dbc.DbMux.RUnlock()
+	// acquired before SetDbVersion can release the version
+	acquireDbVersion(dbc.dbVersion)
+	return &DbPin{Db: dbc.Db, Version: dbc.dbVersion, data: dbc.Data, owned: true}
+}
@@ -13,7 +13,10 @@
 // limitations under the License.
 package common
 
-import "github.com/apid/apid-core/cipher"
+import (
+	"github.com/apid/apid-core/cipher"
+	tran "github.com/apigee-labs/transicator/common"
+)
 
 type ApiManagerInterface interface {
 	InitAPI()
@@ -22,19 +25,27 @@ type ApiManagerInterface interface {
 type DbManagerInterface interface {
 	SetDbVersion(string)
 	GetDbVersion() string
-	GetKmsAttributes(tenantId string, entities ...string) map[string][]Attribute
+	GetKmsAttributes(tenantId string, entities ...string) (map[string][]Attribute, error)
 	GetOrgs() (orgs []string, err error)
+	// Drop any cached data derived from the rows touched by the given KMS changes.
+	InvalidateCache(changes []tran.Change)
 }
 
 type CipherManagerInterface interface {
 	AddOrgs(orgs []string)
+	// Drop the encryption keys of orgs which are no longer in any data scope.
+	RemoveOrgs(orgs []string)
 	// If input is encrypted, it decodes the input with base64,
 	// and then decrypt it. Otherwise, original input is returned.
 	// An encrypted input should be ciphertext prepended with algorithm. An unencrypted input can have any other format.
 	// An example input is "{AES/ECB/PKCS5Padding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=".
+	// The algorithm may be followed by a key id, such as "{AES/ECB/PKCS5Padding/key1}".
 	TryDecryptBase64(input string, org string) (output string, err error)
 	// It encrypts the input, and then encodes the ciphertext with base64.
 	// The returned string is the base64 encoding of the encrypted input, prepended with algorithm.
 	// An example output is "{AES/ECB/PKCS5Padding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4="
+	// An empty mode is the configured default one.
 	EncryptBase64(input string, org string, mode cipher.Mode, padding cipher.Padding) (output string, err error)
+	// Cancel the retrieval of keys, the keys already retrieved remain usable.
+	Close()
 }
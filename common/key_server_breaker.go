@@ -0,0 +1,100 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+const (
+	// consecutive failures opening the circuit
+	keyServerFailureThreshold = 5
+	// how long the circuit stays open before a trial call
+	keyServerCooldown = 30 * time.Second
+)
+
+/*
+ * keyServerBreaker stops calls to the key server after consecutive failures,
+ * so that requests needing a key fail fast instead of waiting for the http timeout.
+ * Once the cooldown has passed, a single trial call is allowed,
+ * which closes the circuit again if it succeeds.
+ */
+type keyServerBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+}
+
+func createKeyServerBreaker(threshold int, cooldown time.Duration) *keyServerBreaker {
+	return &keyServerBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// allow returns whether the key server may be called, a true return must be followed by record
+func (b *keyServerBreaker) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		log.Infof("Key server circuit breaker half-open, trying the key server again")
+		return true
+	case BreakerHalfOpen:
+		// only one trial call at a time
+		return false
+	}
+	return true
+}
+
+// record reports the outcome of a call to the key server
+func (b *keyServerBreaker) record(success bool, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if success {
+		if b.state != BreakerClosed {
+			log.Infof("Key server circuit breaker closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		log.Warnf("Key server circuit breaker open after %d failures, retrying in %v", b.failures, b.cooldown)
+		b.state = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+func (b *keyServerBreaker) stats() (state string, failures int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state, b.failures
+}
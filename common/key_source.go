@@ -0,0 +1,262 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KeySourceHttp = "http"
+	KeySourceFile = "file"
+	KeySourceEnv  = "env"
+)
+
+const DefaultKeyEnvPrefix = "APIMETADATA_ENCRYPTION_KEY_"
+
+// how often the keyring file is checked for changes
+const keyringCheckInterval = time.Duration(time.Second)
+
+// ErrNoKey is returned by a KeySource for an org which has no encryption key.
+var ErrNoKey = errors.New("no encryption key for org")
+
+type EncryptionKey struct {
+	// optional, written in ciphertexts if set
+	Id  string
+	Key []byte
+}
+
+// KeySource provides the current encryption key of orgs.
+type KeySource interface {
+	// GetKey returns the current key of the org, or ErrNoKey if the org has none.
+	// Sources doing I/O stop once the context is cancelled.
+	GetKey(ctx context.Context, org string) (*EncryptionKey, error)
+}
+
+// HttpKeySource retrieves keys from the KMS server.
+type HttpKeySource struct {
+	client        *http.Client
+	serverUrlBase string
+}
+
+func CreateHttpKeySource(client *http.Client, serverUrlBase string) *HttpKeySource {
+	return &HttpKeySource{
+		client:        client,
+		serverUrlBase: serverUrlBase,
+	}
+}
+
+// the body of a key response with a JSON content type, other responses are the base64 key only
+type kmsKeyResponse struct {
+	Id  string `json:"id"`
+	Key string `json:"key"`
+}
+
+func (s *HttpKeySource) GetKey(ctx context.Context, org string) (*EncryptionKey, error) {
+	req, err := http.NewRequest(http.MethodGet, s.serverUrlBase+retrieveEncryptKeyPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retrieving key request for org=%s : %v", org, err)
+	}
+	req = req.WithContext(ctx)
+	pars := req.URL.Query()
+	pars[parameterOrganization] = []string{org}
+	req.URL.RawQuery = pars.Encode()
+	req.Header.Set("Authorization", "Bearer "+services.Config().GetString(configBearerToken))
+	log.Debugf("Retrieving key: %s", req.URL.String())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve key for org=%s : %v", org, err)
+	}
+
+	// if 404
+	if res.StatusCode == http.StatusNotFound {
+		e, err := parseErrorResponse(res)
+		if err != nil {
+			log.Errorf("Failed to parse 404 error response for org %s: %v", org, err)
+			return nil, err
+		}
+		if e.Code == errorCodeNoKey {
+			return nil, ErrNoKey
+		}
+		return nil, fmt.Errorf("failed to retrieve key for org [%v] with status: %v", org, res.Status)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to retrieve key for org [%v] with status: %v", org, res.Status)
+	}
+
+	log.Debugf("Downloaded Encryption Key for org %s", org)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption key: %v", err)
+	}
+	keyResponse := kmsKeyResponse{Key: string(body)}
+	if res.Header.Get(headerContentType) == typeJson {
+		if err = json.Unmarshal(body, &keyResponse); err != nil {
+			return nil, fmt.Errorf("error parsing encryption key response: %v", err)
+		}
+	}
+	return decodeKey(keyResponse.Id, keyResponse.Key)
+}
+
+/*
+ * FileKeySource reads keys from a keyring file, which maps orgs to their base64 key,
+ * or to an object with the id and the base64 key:
+ *   {"org1": "AnrUU5aktASU8kG9A7xM9w==", "org2": {"id": "k2", "key": "AnrUU5aktASU8kG9A7xM9w=="}}
+ * Files with a .json extension are parsed as JSON, others as YAML.
+ * The file is read again whenever it changes.
+ */
+type FileKeySource struct {
+	path      string
+	mutex     sync.Mutex
+	keys      map[string]keyringEntry
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+type keyringEntry struct {
+	Id  string `json:"id" yaml:"id"`
+	Key string `json:"key" yaml:"key"`
+}
+
+func (e *keyringEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Key); err == nil {
+		return nil
+	}
+	type entry keyringEntry
+	return json.Unmarshal(data, (*entry)(e))
+}
+
+func (e *keyringEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.Key); err == nil {
+		return nil
+	}
+	type entry keyringEntry
+	return unmarshal((*entry)(e))
+}
+
+// CreateFileKeySource creates a key source reading the keyring file, which must exist.
+func CreateFileKeySource(path string) (*FileKeySource, error) {
+	s := &FileKeySource{path: path}
+	if err := s.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileKeySource) GetKey(_ context.Context, org string) (*EncryptionKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now := time.Now(); now.Sub(s.checkedAt) >= keyringCheckInterval {
+		// keep the previous keys if the file is being rewritten
+		if err := s.reload(now); err != nil {
+			log.Errorf("Failed to reload keyring %s: %v", s.path, err)
+		}
+	}
+	entry, ok := s.keys[org]
+	if !ok {
+		return nil, ErrNoKey
+	}
+	return decodeKey(entry.Id, entry.Key)
+}
+
+// must be called with the mutex held, or before the source is shared
+func (s *FileKeySource) reload(now time.Time) error {
+	s.checkedAt = now
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if s.keys != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]keyringEntry)
+	if strings.EqualFold(filepath.Ext(s.path), ".json") {
+		err = json.Unmarshal(data, &keys)
+	} else {
+		err = yaml.Unmarshal(data, &keys)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid keyring %s: %v", s.path, err)
+	}
+	log.Debugf("Loaded keyring %s with %d orgs", s.path, len(keys))
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+/*
+ * EnvKeySource reads the key of each org from an environment variable named after the org:
+ * the prefix followed by the org in upper case, with characters other than letters and digits
+ * replaced by "_". The value is the base64 key, optionally preceded by its id and ":".
+ */
+type EnvKeySource struct {
+	prefix string
+}
+
+func CreateEnvKeySource(prefix string) *EnvKeySource {
+	return &EnvKeySource{prefix: prefix}
+}
+
+func (s *EnvKeySource) GetKey(_ context.Context, org string) (*EncryptionKey, error) {
+	value, ok := os.LookupEnv(s.variable(org))
+	if !ok || value == "" {
+		return nil, ErrNoKey
+	}
+	var id string
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		id, value = value[:i], value[i+1:]
+	}
+	return decodeKey(id, value)
+}
+
+func (s *EnvKeySource) variable(org string) string {
+	return s.prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, org)
+}
+
+func decodeKey(id string, key64 string) (*EncryptionKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key64))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding encryption key: %v", err)
+	}
+	return &EncryptionKey{Id: id, Key: key}, nil
+}
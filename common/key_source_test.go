@@ -0,0 +1,124 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"context"
+	"github.com/apid/apid-core/cipher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Key Source", func() {
+	key := []byte{2, 122, 212, 83, 150, 164, 180, 4, 148, 242, 65, 189, 3, 188, 76, 247}
+	keyBase64 := "AnrUU5aktASU8kG9A7xM9w=="
+	key2 := []byte{137, 9, 66, 201, 18, 240, 75, 3, 56, 114, 222, 90, 17, 163, 8, 45}
+	key2Base64 := "iQlCyRLwSwM4ct5aEaMILQ=="
+
+	Context("FileKeySource", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "key_source_")
+			Expect(err).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).Should(Succeed())
+		})
+
+		writeKeyring := func(name string, content string) string {
+			path := filepath.Join(dir, name)
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).Should(Succeed())
+			return path
+		}
+
+		It("should read JSON and YAML keyrings", func() {
+			for _, path := range []string{
+				writeKeyring("keyring.json", `{"org1": "`+keyBase64+`", "org2": {"id": "k2", "key": "`+key2Base64+`"}}`),
+				writeKeyring("keyring.yaml", "org1: "+keyBase64+"\norg2:\n  id: k2\n  key: "+key2Base64+"\n"),
+			} {
+				s, err := CreateFileKeySource(path)
+				Expect(err).Should(Succeed())
+				Expect(s.GetKey(context.Background(), "org1")).Should(Equal(&EncryptionKey{Key: key}))
+				Expect(s.GetKey(context.Background(), "org2")).Should(Equal(&EncryptionKey{Id: "k2", Key: key2}))
+				_, err = s.GetKey(context.Background(), "org3")
+				Expect(err).Should(Equal(ErrNoKey))
+			}
+		})
+
+		It("should fail for a missing or invalid keyring", func() {
+			_, err := CreateFileKeySource(filepath.Join(dir, "missing.json"))
+			Expect(err).ShouldNot(Succeed())
+			_, err = CreateFileKeySource(writeKeyring("keyring.json", `["org1"]`))
+			Expect(err).ShouldNot(Succeed())
+		})
+
+		It("should reload a changed keyring", func() {
+			path := writeKeyring("keyring.json", `{"org1": "`+keyBase64+`"}`)
+			s, err := CreateFileKeySource(path)
+			Expect(err).Should(Succeed())
+
+			writeKeyring("keyring.json", `{"org1": {"id": "k2", "key": "`+key2Base64+`"}}`)
+			Expect(os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))).Should(Succeed())
+			s.checkedAt = time.Time{}
+			Expect(s.GetKey(context.Background(), "org1")).Should(Equal(&EncryptionKey{Id: "k2", Key: key2}))
+
+			// the previous keys are kept while the keyring is invalid
+			writeKeyring("keyring.json", `{"org1": `)
+			Expect(os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))).Should(Succeed())
+			s.checkedAt = time.Time{}
+			Expect(s.GetKey(context.Background(), "org1")).Should(Equal(&EncryptionKey{Id: "k2", Key: key2}))
+		})
+
+		It("should provide keys to the cipher manager", func() {
+			s, err := CreateFileKeySource(writeKeyring("keyring.yaml", "org1: "+keyBase64+"\n"))
+			Expect(err).Should(Succeed())
+			cipherMan := CreateCipherManagerWithSource(s)
+			Expect(cipherMan.TryDecryptBase64("{AES/ECB/PKCS5Padding}2jX3V3dQ5xB9C9Zl9sqyo8pmkvVP10rkEVPVhmnLHw4=", "org1")).
+				Should(Equal("aUWQKgAwmaR0p2kY"))
+			Expect(cipherMan.EncryptBase64("foo", "org2", cipher.ModeEcb, cipher.PaddingPKCS5)).Should(Equal("foo"))
+			Expect(cipherMan.Stats().NoKeyOrgs).Should(Equal(1))
+		})
+	})
+
+	Context("EnvKeySource", func() {
+		prefix := "TEST_APIMETADATA_KEY_"
+
+		AfterEach(func() {
+			Expect(os.Unsetenv(prefix + "ORG_1")).Should(Succeed())
+		})
+
+		It("should read keys from environment variables", func() {
+			s := CreateEnvKeySource(prefix)
+			_, err := s.GetKey(context.Background(), "org-1")
+			Expect(err).Should(Equal(ErrNoKey))
+
+			Expect(os.Setenv(prefix+"ORG_1", keyBase64)).Should(Succeed())
+			Expect(s.GetKey(context.Background(), "org-1")).Should(Equal(&EncryptionKey{Key: key}))
+
+			Expect(os.Setenv(prefix+"ORG_1", "k2:"+key2Base64)).Should(Succeed())
+			Expect(s.GetKey(context.Background(), "org-1")).Should(Equal(&EncryptionKey{Id: "k2", Key: key2}))
+
+			Expect(os.Setenv(prefix+"ORG_1", "not base64")).Should(Succeed())
+			_, err = s.GetKey(context.Background(), "org-1")
+			Expect(err).ShouldNot(Succeed())
+		})
+	})
+})
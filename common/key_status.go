@@ -0,0 +1,128 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// the org has a key
+	KeyStateLoaded = "loaded"
+	// the key source has no key for the org
+	KeyStateAbsent = "absent"
+	// the last retrieval failed, and no retry is scheduled
+	KeyStateFailing = "failing"
+	// the last retrieval failed, and a retry is scheduled
+	KeyStateRetrying = "retrying"
+	// the key has not been retrieved yet
+	KeyStatePending = "pending"
+)
+
+// KeyStatus describes the encryption key of an org, without the key itself.
+type KeyStatus struct {
+	Org   string
+	State string
+	// id and fingerprint of the current key, empty unless loaded
+	KeyId       string
+	Fingerprint string
+	// number of keys kept for decryption, the current one included
+	Keys int
+	// last successful retrieval, and last retrieval
+	LastFetch   time.Time
+	LastAttempt time.Time
+	// error of the last retrieval, empty if it succeeded
+	LastError string
+}
+
+// the outcome of the retrievals of the key of an org
+type keyFetchStatus struct {
+	lastFetch   time.Time
+	lastAttempt time.Time
+	lastError   string
+	// the key source had no key for the org at the last successful retrieval
+	absent bool
+}
+
+// recordFetch records the outcome of a retrieval, absent if it found that the org has no key
+func (c *KmsCipherManager) recordFetch(org string, now time.Time, absent bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := c.fetchStatus[org]
+	if status == nil {
+		status = &keyFetchStatus{}
+		c.fetchStatus[org] = status
+	}
+	status.lastAttempt = now
+	if err != nil {
+		status.lastError = err.Error()
+		return
+	}
+	status.lastFetch = now
+	status.lastError = ""
+	status.absent = absent
+}
+
+// KeyStatuses returns the status of the key of each known org, sorted by org.
+func (c *KmsCipherManager) KeyStatuses() []KeyStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	orgs := make(map[string]bool)
+	for org := range c.orgs {
+		orgs[org] = true
+	}
+	for org := range c.keys {
+		orgs[org] = true
+	}
+	for org := range c.noKey {
+		orgs[org] = true
+	}
+	for org := range c.fetchStatus {
+		orgs[org] = true
+	}
+
+	statuses := make([]KeyStatus, 0, len(orgs))
+	for org := range orgs {
+		status := KeyStatus{Org: org}
+		absent := false
+		if fetch := c.fetchStatus[org]; fetch != nil {
+			status.LastFetch = fetch.lastFetch
+			status.LastAttempt = fetch.lastAttempt
+			status.LastError = fetch.lastError
+			absent = fetch.absent
+		}
+		keys := c.keys[org]
+		switch {
+		case len(keys) > 0:
+			status.State = KeyStateLoaded
+			status.KeyId = keys[0].id
+			status.Fingerprint = keys[0].fingerprint
+			status.Keys = len(keys)
+		case absent:
+			status.State = KeyStateAbsent
+		case status.LastError != "" && c.retrieving[org]:
+			status.State = KeyStateRetrying
+		case status.LastError != "":
+			status.State = KeyStateFailing
+		default:
+			status.State = KeyStatePending
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Org < statuses[j].Org
+	})
+	return statuses
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// number of DB versions whose compiled resources are kept
+const maxResourceMatcherVersions = 2
+
+/*
+ * ResourceMatcher matches request paths against the resources of apiproducts,
+ * with the semantics of Apigee resource paths:
+ *   "/"      any path, or only the base path with SingleForwardSlashBlocking
+ *   "/**"    any path starting with "/"
+ *   "/*"     a single path segment, such as "/foo" but not "/foo/bar"
+ *   "/a/**"  any path below "/a/", "/a/" included
+ *   "/a/*"   a single path segment below "/a/"
+ *   "/a"     "/a" only
+ * Patterns are anchored at both ends, and any other character matches literally.
+ * Compiled resources are cached per DB version and apiproduct, and are immutable once cached,
+ * so that concurrent matches only share a read lock.
+ * A nil *ResourceMatcher is valid and caches nothing.
+ */
+type ResourceMatcher struct {
+	// if true, "/" only matches the base path
+	SingleForwardSlashBlocking bool
+	mutex                      sync.RWMutex
+	// DB versions in the cache, from the oldest
+	versions []string
+	// by DB version, then apiproduct id
+	compiled map[string]map[string]*compiledResources
+}
+
+type compiledResources struct {
+	// the resources the patterns were compiled from
+	resources []string
+	patterns  []*regexp.Regexp
+}
+
+func CreateResourceMatcher(singleForwardSlashBlocking bool) *ResourceMatcher {
+	return &ResourceMatcher{
+		SingleForwardSlashBlocking: singleForwardSlashBlocking,
+		compiled:                   make(map[string]map[string]*compiledResources),
+	}
+}
+
+// MatchResource matches the path against the resources without caching, see ResourceMatcher.
+func MatchResource(resources []string, path string) (string, bool) {
+	var m *ResourceMatcher
+	return m.Match("", "", resources, path)
+}
+
+/*
+ * Match returns the first resource matching the path, and whether any did.
+ * An empty list of resources matches any path.
+ * The compiled resources are cached by dbVersion and productId, unless productId is empty.
+ */
+func (m *ResourceMatcher) Match(dbVersion, productId string, resources []string, path string) (string, bool) {
+	if len(resources) == 0 {
+		return "", true
+	}
+	for i, pattern := range m.patterns(dbVersion, productId, resources) {
+		if pattern != nil && pattern.MatchString(path) {
+			return resources[i], true
+		}
+	}
+	return "", false
+}
+
+func (m *ResourceMatcher) patterns(dbVersion, productId string, resources []string) []*regexp.Regexp {
+	if m == nil {
+		return compileResources(resources, false)
+	}
+	if productId == "" {
+		return compileResources(resources, m.SingleForwardSlashBlocking)
+	}
+	m.mutex.RLock()
+	c := m.compiled[dbVersion][productId]
+	m.mutex.RUnlock()
+	// resources may still change within a DB version through change lists
+	if c != nil && equalStrings(c.resources, resources) {
+		return c.patterns
+	}
+	c = &compiledResources{
+		resources: append([]string(nil), resources...),
+		patterns:  compileResources(resources, m.SingleForwardSlashBlocking),
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	byProduct := m.compiled[dbVersion]
+	if byProduct == nil {
+		byProduct = make(map[string]*compiledResources)
+		m.compiled[dbVersion] = byProduct
+		m.versions = append(m.versions, dbVersion)
+		for len(m.versions) > maxResourceMatcherVersions {
+			delete(m.compiled, m.versions[0])
+			m.versions = m.versions[1:]
+		}
+	}
+	// a concurrent match may have compiled the same resources meanwhile
+	if cached := byProduct[productId]; cached != nil && equalStrings(cached.resources, resources) {
+		return cached.patterns
+	}
+	byProduct[productId] = c
+	return c.patterns
+}
+
+// invalid resources get a nil pattern, which matches nothing
+func compileResources(resources []string, singleForwardSlashBlocking bool) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(resources))
+	for i, resource := range resources {
+		pattern, err := regexp.Compile(resourceToRegexp(resource, singleForwardSlashBlocking))
+		if err != nil {
+			log.Errorf("Invalid apiproduct resource %s: %v", resource, err)
+			continue
+		}
+		patterns[i] = pattern
+	}
+	return patterns
+}
+
+func resourceToRegexp(resource string, singleForwardSlashBlocking bool) string {
+	if resource == "/" {
+		if singleForwardSlashBlocking {
+			return "^/?$"
+		}
+		resource = "/**"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for len(resource) > 0 {
+		if resource[0] == '*' {
+			stars := len(resource) - len(strings.TrimLeft(resource, "*"))
+			if stars > 1 {
+				buf.WriteString(".*")
+			} else {
+				buf.WriteString("[^/]+")
+			}
+			resource = resource[stars:]
+			continue
+		}
+		literal := len(resource)
+		if i := strings.IndexByte(resource, '*'); i >= 0 {
+			literal = i
+		}
+		buf.WriteString(regexp.QuoteMeta(resource[:literal]))
+		resource = resource[literal:]
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strconv"
+	"sync"
+)
+
+var _ = Describe("Resource Matcher", func() {
+
+	Context("Semantics", func() {
+		It("should match any path for no resources", func() {
+			resource, ok := MatchResource(nil, "/foo")
+			Expect(ok).Should(BeTrue())
+			Expect(resource).Should(BeEmpty())
+		})
+
+		It("should match with Apigee semantics", func() {
+			testData := []struct {
+				resource string
+				path     string
+				expected bool
+			}{
+				{"/", "/", true},
+				{"/", "/foo/bar", true},
+				{"/**", "/", true},
+				{"/**", "/foo/bar", true},
+				{"/**", "foo", false},
+				{"/*", "/foo", true},
+				{"/*", "/foo/bar", false},
+				{"/*", "/", false},
+				{"/foo/**", "/foo/", true},
+				{"/foo/**", "/foo/bar/baz", true},
+				{"/foo/**", "/x/foo/bar", false},
+				{"/foo/*", "/foo/bar", true},
+				{"/foo/*", "/foo/bar/baz", false},
+				{"/foo/*", "/x/foo/bar/baz", false},
+				{"/foo/*/baz", "/foo/bar/baz", true},
+				{"/foo/*/baz", "/foo/bar/baz/x", false},
+				{"/foo/***/baz", "/foo/a/b/baz", true},
+				{"/foo", "/foo", true},
+				{"/foo", "/foo/bar", false},
+				{"/foo", "/x/foo", false},
+			}
+			for _, td := range testData {
+				_, ok := MatchResource([]string{td.resource}, td.path)
+				Expect(ok).Should(Equal(td.expected), td.resource+" vs "+td.path)
+			}
+		})
+
+		It("should match regex metacharacters literally", func() {
+			testData := []struct {
+				resource string
+				path     string
+				expected bool
+			}{
+				{"/v1.0/*", "/v1.0/foo", true},
+				{"/v1.0/*", "/v1x0/foo", false},
+				{"/a+b", "/a+b", true},
+				{"/a+b", "/aab", false},
+				{"/foo?", "/foo?", true},
+				{"/foo?", "/fo", false},
+				{"/(x|y)", "/x", false},
+				{"/[", "/[", true},
+			}
+			for _, td := range testData {
+				_, ok := MatchResource([]string{td.resource}, td.path)
+				Expect(ok).Should(Equal(td.expected), td.resource+" vs "+td.path)
+			}
+		})
+
+		It("should return the first matching resource", func() {
+			resource, ok := MatchResource([]string{"/a/*", "/b/**", "/**"}, "/b/c")
+			Expect(ok).Should(BeTrue())
+			Expect(resource).Should(Equal("/b/**"))
+			_, ok = MatchResource([]string{"/a/*", "/b/**"}, "/c")
+			Expect(ok).Should(BeFalse())
+		})
+
+		It("should only match the base path for single forward slash blocking", func() {
+			matcher := CreateResourceMatcher(true)
+			for _, productId := range []string{"", "p1"} {
+				_, ok := matcher.Match("v1", productId, []string{"/"}, "/")
+				Expect(ok).Should(BeTrue())
+				_, ok = matcher.Match("v1", productId, []string{"/"}, "")
+				Expect(ok).Should(BeTrue())
+				_, ok = matcher.Match("v1", productId, []string{"/"}, "/foo")
+				Expect(ok).Should(BeFalse())
+			}
+		})
+	})
+
+	Context("Cache", func() {
+		var matcher *ResourceMatcher
+
+		BeforeEach(func() {
+			matcher = CreateResourceMatcher(false)
+		})
+
+		It("should reuse compiled resources per DB version and product", func() {
+			patterns := matcher.patterns("v1", "p1", []string{"/a/**"})
+			Expect(matcher.patterns("v1", "p1", []string{"/a/**"})[0]).Should(BeIdenticalTo(patterns[0]))
+			Expect(matcher.patterns("v1", "p2", []string{"/a/**"})[0]).ShouldNot(BeIdenticalTo(patterns[0]))
+			Expect(matcher.patterns("v2", "p1", []string{"/a/**"})[0]).ShouldNot(BeIdenticalTo(patterns[0]))
+		})
+
+		It("should recompile changed resources", func() {
+			_, ok := matcher.Match("v1", "p1", []string{"/a/**"}, "/b/c")
+			Expect(ok).Should(BeFalse())
+			_, ok = matcher.Match("v1", "p1", []string{"/b/**"}, "/b/c")
+			Expect(ok).Should(BeTrue())
+		})
+
+		It("should only keep the latest DB versions", func() {
+			for _, version := range []string{"v1", "v2", "v3"} {
+				matcher.Match(version, "p1", []string{"/a/**"}, "/a/b")
+			}
+			Expect(matcher.versions).Should(Equal([]string{"v2", "v3"}))
+			Expect(matcher.compiled).Should(HaveLen(2))
+			Expect(matcher.compiled).ShouldNot(HaveKey("v1"))
+		})
+
+		It("should match concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					defer GinkgoRecover()
+					for j := 0; j < 100; j++ {
+						version := "v" + strconv.Itoa(j%3)
+						_, ok := matcher.Match(version, "p"+strconv.Itoa(i%2), []string{"/a/**"}, "/a/b")
+						Expect(ok).Should(BeTrue())
+					}
+				}(i)
+			}
+			wg.Wait()
+			Expect(len(matcher.compiled)).Should(BeNumerically("<=", maxResourceMatcherVersions))
+		})
+
+		It("should not cache without a product id", func() {
+			matcher.Match("v1", "", []string{"/a/**"}, "/a/b")
+			Expect(matcher.compiled).Should(BeEmpty())
+		})
+	})
+})
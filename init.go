@@ -15,7 +15,9 @@
 package apidApiMetadata
 
 import (
+	"fmt"
 	"github.com/apid/apid-core"
+	"github.com/apid/apid-core/cipher"
 	"github.com/apid/apid-core/util"
 	"github.com/apid/apidApiMetadata/accessEntity"
 	"github.com/apid/apidApiMetadata/common"
@@ -30,6 +32,29 @@ const (
 	httpTimeout              = 5 * time.Minute
 	configBearerToken        = "apigeesync_bearer_token"
 	configRetrieveEncKeyBase = "apimetadata_encryption_key_server_base"
+	// how often encryption keys are retrieved again to pick up rotations, 0 disables the refresh
+	configEncKeyRefreshInterval = "apimetadata_encryption_key_refresh_interval"
+	// where encryption keys come from: http (the key server), file (a keyring file) or env (environment variables)
+	configEncKeySource    = "apimetadata_encryption_key_source"
+	configEncKeyringFile  = "apimetadata_encryption_keyring_file"
+	configEncKeyEnvPrefix = "apimetadata_encryption_key_env_prefix"
+	// mode of encryptions which do not specify one: GCM, CBC or ECB
+	configEncDefaultMode = "apimetadata_encryption_default_mode"
+	// if true, only authenticated modes (GCM) are allowed for encryptions
+	configEncStrict = "apimetadata_encryption_strict"
+	// max number of (org, key) entries cached by verify api key, 0 disables the cache
+	configVerifyCacheSize = "apimetadata_verify_apikey_cache_size"
+	configVerifyCacheTTL  = "apimetadata_verify_apikey_cache_ttl"
+	// if true, the apiproduct resource "/" only matches the base path instead of any path
+	configSingleForwardSlashBlocking = "apimetadata_single_forward_slash_blocking"
+
+	configQuotaEnabled = "apimetadata_quota_enabled"
+	configQuotaWindow  = "apimetadata_quota_window"
+	// how access entity returns secrets, as [endpoint:]field=action rules overriding the defaults,
+	// e.g. "appcredentials:consumerSecret=encrypt,password=omit"
+	configEntityRedaction = "apimetadata_access_entity_redaction"
+	// if true, access entity returns the apiProductReferences of credentials as names, without their status
+	configEntityLegacyProductReferences = "apimetadata_access_entity_legacy_product_references"
 )
 
 var (
@@ -48,7 +73,9 @@ func initPlugin(s apid.Services) (apid.PluginData, error) {
 	accessEntity.SetApidServices(services, log)
 	common.SetApidServices(services, log)
 	log.Debug("start init")
-	initManagers(services)
+	if _, err := initManagers(services); err != nil {
+		return common.PluginData, err
+	}
 	log.Debug("end init")
 
 	return common.PluginData, nil
@@ -69,9 +96,47 @@ func createHttpClient() *http.Client {
 	return client
 }
 
-func initManagers(services apid.Services) *apigeeSyncHandler {
+func createKeySource(services apid.Services) (common.KeySource, error) {
+	switch source := services.Config().GetString(configEncKeySource); source {
+	case common.KeySourceHttp:
+		return common.CreateHttpKeySource(createHttpClient(), services.Config().GetString(configRetrieveEncKeyBase)), nil
+	case common.KeySourceFile:
+		return common.CreateFileKeySource(services.Config().GetString(configEncKeyringFile))
+	case common.KeySourceEnv:
+		return common.CreateEnvKeySource(services.Config().GetString(configEncKeyEnvPrefix)), nil
+	default:
+		return nil, fmt.Errorf("unknown %s: %s", configEncKeySource, source)
+	}
+}
+
+func initManagers(services apid.Services) (*apigeeSyncHandler, error) {
+	services.Config().SetDefault(configVerifyCacheSize, verifyApiKey.DefaultCacheSize)
+	services.Config().SetDefault(configVerifyCacheTTL, verifyApiKey.DefaultCacheTTL)
+
+	services.Config().SetDefault(configSingleForwardSlashBlocking, false)
+	services.Config().SetDefault(configQuotaEnabled, false)
+	services.Config().SetDefault(configQuotaWindow, verifyApiKey.QuotaWindowFixed)
+	services.Config().SetDefault(configEncKeyRefreshInterval, common.DefaultKeyRefreshInterval)
+	services.Config().SetDefault(configEncKeySource, common.KeySourceHttp)
+	services.Config().SetDefault(configEncKeyEnvPrefix, common.DefaultKeyEnvPrefix)
+	services.Config().SetDefault(configEncDefaultMode, string(common.DefaultEncryptionMode))
+	services.Config().SetDefault(configEncStrict, false)
+	services.Config().SetDefault(configEntityLegacyProductReferences, false)
 
-	cipherMan := common.CreateCipherManager(createHttpClient(), services.Config().GetString(configRetrieveEncKeyBase))
+	keySource, err := createKeySource(services)
+	if err != nil {
+		return nil, err
+	}
+	cipherMan := common.CreateCipherManagerWithSource(keySource)
+	err = cipherMan.SetEncryptionMode(
+		cipher.Mode(services.Config().GetString(configEncDefaultMode)),
+		services.Config().GetBool(configEncStrict),
+	)
+	if err != nil {
+		return nil, err
+	}
+	cipherMan.StartKeyRefresh(services.Config().GetDuration(configEncKeyRefreshInterval))
+	resourceMatcher := common.CreateResourceMatcher(services.Config().GetBool(configSingleForwardSlashBlocking))
 
 	verifyDbMan := &verifyApiKey.DbManager{
 		DbManager: common.DbManager{
@@ -79,30 +144,54 @@ func initManagers(services apid.Services) *apigeeSyncHandler {
 			DbMux:         sync.RWMutex{},
 			CipherManager: cipherMan,
 		},
+		Cache: verifyApiKey.CreateApiKeyCache(
+			services.Config().GetInt(configVerifyCacheSize),
+			services.Config().GetDuration(configVerifyCacheTTL),
+		),
 	}
 	verifyApiMan := &verifyApiKey.ApiManager{
 		DbMan:             verifyDbMan,
 		VerifiersEndpoint: verifyApiKey.ApiPath,
+		ResourceMatcher:   resourceMatcher,
+	}
+	if services.Config().GetBool(configQuotaEnabled) {
+		verifyApiMan.Quota = verifyApiKey.CreateQuotaManager(
+			verifyApiKey.CreateInMemoryQuotaCounter(),
+			services.Config().GetString(configQuotaWindow),
+		)
 	}
 
 	entityDbMan := &accessEntity.DbManager{
 		DbManager: common.DbManager{
-			Data:          services.Data(),
-			DbMux:         sync.RWMutex{},
-			CipherManager: cipherMan,
+			Data:            services.Data(),
+			DbMux:           sync.RWMutex{},
+			CipherManager:   cipherMan,
+			ResourceMatcher: resourceMatcher,
 		},
 	}
 
+	redaction, err := accessEntity.CreateRedactionPolicy(services.Config().GetString(configEntityRedaction))
+	if err != nil {
+		return nil, err
+	}
 	entityApiMan := &accessEntity.ApiManager{
-		DbMan:            entityDbMan,
-		AccessEntityPath: accessEntity.AccessEntityPath,
+		DbMan:                   entityDbMan,
+		AccessEntityPath:        accessEntity.AccessEntityPath,
+		Redaction:               redaction,
+		CipherManager:           cipherMan,
+		LegacyProductReferences: services.Config().GetBool(configEntityLegacyProductReferences),
+	}
+
+	keysApiMan := &keysApiManager{
+		cipherMan: cipherMan,
+		path:      keysApiPath,
 	}
 
 	syncHandler := &apigeeSyncHandler{
 		dbMans:    []common.DbManagerInterface{verifyDbMan, entityDbMan},
-		apiMans:   []common.ApiManagerInterface{verifyApiMan, entityApiMan},
+		apiMans:   []common.ApiManagerInterface{verifyApiMan, entityApiMan, keysApiMan},
 		cipherMan: cipherMan,
 	}
 	syncHandler.initListener(services)
-	return syncHandler
+	return syncHandler, nil
 }
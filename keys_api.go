@@ -0,0 +1,113 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apidApiMetadata
+
+import (
+	"encoding/json"
+	"github.com/apid/apidApiMetadata/common"
+	"net/http"
+	"time"
+)
+
+const keysApiPath = "/apimetadata/keys"
+
+type keyStatusProvider interface {
+	KeyStatuses() []common.KeyStatus
+	Stats() common.KmsCipherStats
+}
+
+// keysApiManager serves the status of the encryption keys to operators, never the keys themselves.
+type keysApiManager struct {
+	cipherMan      keyStatusProvider
+	path           string
+	apiInitialized bool
+}
+
+type keysResponse struct {
+	KeyServer keyServerStatus `json:"keyServer"`
+	Orgs      []orgKeyStatus  `json:"orgs"`
+}
+
+type keyServerStatus struct {
+	// state of the circuit breaker: closed, open or half-open
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	// orgs known to have no key
+	NoKeyOrgs     int    `json:"noKeyOrgs"`
+	SharedFetches uint64 `json:"sharedFetches"`
+}
+
+type orgKeyStatus struct {
+	Org         string `json:"org"`
+	State       string `json:"state"`
+	KeyId       string `json:"keyId,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Keys        int    `json:"keys"`
+	// RFC3339 times, omitted if there was none
+	LastFetch   string `json:"lastFetch,omitempty"`
+	LastAttempt string `json:"lastAttempt,omitempty"`
+	LastError   string `json:"lastError,omitempty"`
+}
+
+func (a *keysApiManager) InitAPI() {
+	if a.apiInitialized {
+		return
+	}
+	services.API().HandleFunc(a.path, a.HandleKeys).Methods("GET")
+	a.apiInitialized = true
+	log.Debug("Keys API endpoint initialized")
+}
+
+func (a *keysApiManager) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	stats := a.cipherMan.Stats()
+	response := keysResponse{
+		KeyServer: keyServerStatus{
+			State:         stats.KeyServerState,
+			Failures:      stats.KeyServerFailures,
+			NoKeyOrgs:     stats.NoKeyOrgs,
+			SharedFetches: stats.SharedFetches,
+		},
+		Orgs: []orgKeyStatus{},
+	}
+	for _, s := range a.cipherMan.KeyStatuses() {
+		response.Orgs = append(response.Orgs, orgKeyStatus{
+			Org:         s.Org,
+			State:       s.State,
+			KeyId:       s.KeyId,
+			Fingerprint: s.Fingerprint,
+			Keys:        s.Keys,
+			LastFetch:   formatTime(s.LastFetch),
+			LastAttempt: formatTime(s.LastAttempt),
+			LastError:   s.LastError,
+		})
+	}
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("Failed to marshal key statuses: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(bytes); err != nil {
+		log.Errorf("Failed to write key statuses: %v", err)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
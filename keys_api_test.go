@@ -0,0 +1,64 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apidApiMetadata
+
+import (
+	"encoding/json"
+	"github.com/apid/apidApiMetadata/common"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Keys API", func() {
+
+	It("should list the key status of orgs", func() {
+		fetched := time.Date(2017, time.August, 17, 13, 47, 31, 0, time.UTC)
+		a := &keysApiManager{
+			cipherMan: &DummyKeyStatusProvider{
+				statuses: []common.KeyStatus{
+					{Org: "org1", State: common.KeyStateLoaded, KeyId: "k1", Fingerprint: "0a1b2c3d4e5f6a7b", Keys: 2, LastFetch: fetched, LastAttempt: fetched},
+					{Org: "org2", State: common.KeyStateFailing, LastAttempt: fetched, LastError: "connection refused"},
+				},
+				stats: common.KmsCipherStats{KeyServerState: common.BreakerOpen, KeyServerFailures: 5},
+			},
+			path: keysApiPath,
+		}
+		w := httptest.NewRecorder()
+		a.HandleKeys(w, httptest.NewRequest(http.MethodGet, keysApiPath, nil))
+		Expect(w.Code).Should(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).Should(Equal("application/json"))
+		Expect(w.Body.String()).Should(MatchJSON(`{
+			"keyServer": {"state": "open", "failures": 5, "noKeyOrgs": 0, "sharedFetches": 0},
+			"orgs": [
+				{"org": "org1", "state": "loaded", "keyId": "k1", "fingerprint": "0a1b2c3d4e5f6a7b", "keys": 2,
+				 "lastFetch": "2017-08-17T13:47:31Z", "lastAttempt": "2017-08-17T13:47:31Z"},
+				{"org": "org2", "state": "failing", "keys": 0, "lastAttempt": "2017-08-17T13:47:31Z", "lastError": "connection refused"}
+			]
+		}`))
+	})
+
+	It("should list no orgs as an empty array", func() {
+		a := &keysApiManager{cipherMan: &DummyKeyStatusProvider{}, path: keysApiPath}
+		w := httptest.NewRecorder()
+		a.HandleKeys(w, httptest.NewRequest(http.MethodGet, keysApiPath, nil))
+		var response keysResponse
+		Expect(json.Unmarshal(w.Body.Bytes(), &response)).Should(Succeed())
+		Expect(response.Orgs).ShouldNot(BeNil())
+		Expect(response.Orgs).Should(BeEmpty())
+	})
+})
@@ -18,12 +18,19 @@ import (
 	"github.com/apid/apid-core"
 	"github.com/apid/apidApiMetadata/common"
 	tran "github.com/apigee-labs/transicator/common"
+	"strings"
 )
 
 const (
 	APIGEE_SYNC_EVENT = "ApigeeSync"
 )
 
+const (
+	tableDataScope = "edgex_data_scope"
+	tablePrefixKms = "kms_"
+	columnOrg      = "org"
+)
+
 type apigeeSyncHandler struct {
 	dbMans    []common.DbManagerInterface
 	apiMans   []common.ApiManagerInterface
@@ -32,6 +39,11 @@ type apigeeSyncHandler struct {
 
 func (h *apigeeSyncHandler) initListener(services apid.Services) {
 	services.Events().Listen(APIGEE_SYNC_EVENT, h)
+	// stop retrieving encryption keys when apid shuts down
+	services.Events().ListenFunc(apid.ShutdownEventSelector, func(e apid.Event) {
+		log.Debugf("Shutdown event received. Stopping key retrieval: %v", e)
+		h.cipherMan.Close()
+	})
 }
 
 func (h *apigeeSyncHandler) String() string {
@@ -62,11 +74,100 @@ func (h *apigeeSyncHandler) processSnapshot(snapshot *tran.Snapshot) {
 	log.Debug("Snapshot processed")
 }
 
+func (h *apigeeSyncHandler) processChangeList(changes *tran.ChangeList) {
+	log.Debugf("Changelist received with %d changes", len(changes.Changes))
+	var addedOrgs, removedOrgs []string
+	var kmsChanges []tran.Change
+	for _, change := range changes.Changes {
+		table := common.NormalizeTableName(change.Table)
+		switch {
+		case table == tableDataScope:
+			switch change.Operation {
+			case tran.Insert:
+				addedOrgs = appendOrg(addedOrgs, getOrg(change.NewRow))
+			case tran.Update:
+				if oldOrg, newOrg := getOrg(change.OldRow), getOrg(change.NewRow); oldOrg != newOrg {
+					removedOrgs = appendOrg(removedOrgs, oldOrg)
+					addedOrgs = appendOrg(addedOrgs, newOrg)
+				}
+			case tran.Delete:
+				removedOrgs = appendOrg(removedOrgs, getOrg(change.OldRow))
+			}
+		case strings.HasPrefix(table, tablePrefixKms):
+			kmsChanges = append(kmsChanges, change)
+		}
+	}
+
+	// an org is only removed when no data scope refers to it anymore
+	if len(removedOrgs) > 0 {
+		orgs, err := h.dbMans[0].GetOrgs()
+		if err != nil {
+			log.Errorf("Failed to get orgs: %v", err)
+		} else if removedOrgs = subtractOrgs(removedOrgs, orgs); len(removedOrgs) > 0 {
+			log.Debugf("Removing encryption keys for orgs: %v", removedOrgs)
+			h.cipherMan.RemoveOrgs(removedOrgs)
+		}
+	}
+	// retrieve encryption keys for new orgs
+	if len(addedOrgs) > 0 {
+		log.Debugf("Retrieving encryption keys for orgs: %v", addedOrgs)
+		h.cipherMan.AddOrgs(addedOrgs)
+	}
+	// invalidate cached entities for all packages
+	if len(kmsChanges) > 0 {
+		for _, dbMan := range h.dbMans {
+			dbMan.InvalidateCache(kmsChanges)
+		}
+	}
+	log.Debug("Changelist processed")
+}
+
 func (h *apigeeSyncHandler) Handle(e apid.Event) {
 
 	if snapData, ok := e.(*tran.Snapshot); ok {
 		h.processSnapshot(snapData)
-	} else { //TODO handle changelist and retrieve key for new orgs
+	} else if changeList, ok := e.(*tran.ChangeList); ok {
+		h.processChangeList(changeList)
+	} else {
 		log.Debugf("Received event. No action required for apiMetadata plugin. Ignoring. %v", e)
 	}
 }
+
+func getOrg(row tran.Row) string {
+	if row == nil {
+		return ""
+	}
+	var org string
+	if err := row.Get(columnOrg, &org); err != nil {
+		log.Warnf("Failed to get org from data scope change: %v", err)
+		return ""
+	}
+	return org
+}
+
+func appendOrg(orgs []string, org string) []string {
+	if org == "" {
+		return orgs
+	}
+	for _, o := range orgs {
+		if o == org {
+			return orgs
+		}
+	}
+	return append(orgs, org)
+}
+
+// returns orgs in "from" which are not in "orgs"
+func subtractOrgs(from []string, orgs []string) []string {
+	current := make(map[string]bool)
+	for _, org := range orgs {
+		current[org] = true
+	}
+	var ret []string
+	for _, org := range from {
+		if !current[org] {
+			ret = append(ret, org)
+		}
+	}
+	return ret
+}
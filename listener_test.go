@@ -29,6 +29,7 @@ var _ = Describe("listener", func() {
 
 	var listenerTestSyncHandler *apigeeSyncHandler
 	var listnerTestTempDir string
+	var testCipherMan *DummyCipherMan
 	var _ = BeforeEach(func() {
 		var err error
 		listnerTestTempDir, err = ioutil.TempDir("", "listner_test")
@@ -39,10 +40,11 @@ var _ = Describe("listener", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		apid.InitializePlugins("")
+		testCipherMan = &DummyCipherMan{}
 		listenerTestSyncHandler = &apigeeSyncHandler{
 			dbMans:    []common.DbManagerInterface{&DummyDbMan{}, &DummyDbMan{}},
 			apiMans:   []common.ApiManagerInterface{},
-			cipherMan: &DummyCipherMan{},
+			cipherMan: testCipherMan,
 		}
 		listenerTestSyncHandler.initListener(services)
 	})
@@ -80,4 +82,103 @@ var _ = Describe("listener", func() {
 		})
 
 	})
+
+	Context("Apigee Sync ChangeList Processing", func() {
+
+		orgRow := func(org string) tran.Row {
+			return tran.Row{
+				"org": &tran.ColumnVal{Value: org},
+			}
+		}
+
+		It("should retrieve keys for orgs added to data scope", func() {
+			s := &tran.ChangeList{
+				Changes: []tran.Change{
+					{
+						Operation: tran.Insert,
+						Table:     "edgex.data_scope",
+						NewRow:    orgRow("org1"),
+					},
+					{
+						Operation: tran.Insert,
+						Table:     "edgex.data_scope",
+						NewRow:    orgRow("org1"),
+					},
+					{
+						Operation: tran.Insert,
+						Table:     "edgex.data_scope",
+						NewRow:    orgRow("org2"),
+					},
+				},
+			}
+			listenerTestSyncHandler.Handle(s)
+			Expect(testCipherMan.addedOrgs).Should(Equal([]string{"org1", "org2"}))
+			Expect(testCipherMan.removedOrgs).Should(BeEmpty())
+		})
+
+		It("should remove keys for orgs no longer in any data scope", func() {
+			listenerTestSyncHandler.dbMans[0].(*DummyDbMan).orgs = []string{"org2"}
+			s := &tran.ChangeList{
+				Changes: []tran.Change{
+					{
+						Operation: tran.Delete,
+						Table:     "edgex.data_scope",
+						OldRow:    orgRow("org1"),
+					},
+					{
+						Operation: tran.Delete,
+						Table:     "edgex.data_scope",
+						OldRow:    orgRow("org2"),
+					},
+				},
+			}
+			listenerTestSyncHandler.Handle(s)
+			Expect(testCipherMan.removedOrgs).Should(Equal([]string{"org1"}))
+			Expect(testCipherMan.addedOrgs).Should(BeEmpty())
+		})
+
+		It("should handle org change of a data scope", func() {
+			s := &tran.ChangeList{
+				Changes: []tran.Change{
+					{
+						Operation: tran.Update,
+						Table:     "edgex.data_scope",
+						OldRow:    orgRow("org1"),
+						NewRow:    orgRow("org2"),
+					},
+					{
+						Operation: tran.Update,
+						Table:     "edgex.data_scope",
+						OldRow:    orgRow("org3"),
+						NewRow:    orgRow("org3"),
+					},
+				},
+			}
+			listenerTestSyncHandler.Handle(s)
+			Expect(testCipherMan.removedOrgs).Should(Equal([]string{"org1"}))
+			Expect(testCipherMan.addedOrgs).Should(Equal([]string{"org2"}))
+		})
+
+		It("should invalidate caches for kms changes", func() {
+			kmsChange := tran.Change{
+				Operation: tran.Update,
+				Table:     "kms.app_credential",
+			}
+			s := &tran.ChangeList{
+				Changes: []tran.Change{
+					kmsChange,
+					{
+						Operation: tran.Insert,
+						Table:     "edgex.apid_cluster",
+					},
+				},
+			}
+			listenerTestSyncHandler.Handle(s)
+			for _, dbMan := range listenerTestSyncHandler.dbMans {
+				Expect(dbMan.(*DummyDbMan).changes).Should(Equal([]tran.Change{kmsChange}))
+			}
+			Expect(testCipherMan.addedOrgs).Should(BeEmpty())
+			Expect(testCipherMan.removedOrgs).Should(BeEmpty())
+		})
+	})
 })
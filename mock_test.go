@@ -16,14 +16,21 @@ package apidApiMetadata
 import (
 	"github.com/apid/apid-core/cipher"
 	"github.com/apid/apidApiMetadata/common"
+	tran "github.com/apigee-labs/transicator/common"
 )
 
 type DummyDbMan struct {
 	version string
+	orgs    []string
+	changes []tran.Change
 }
 
 func (d *DummyDbMan) GetOrgs() (orgs []string, err error) {
-	return
+	return d.orgs, nil
+}
+
+func (d *DummyDbMan) InvalidateCache(changes []tran.Change) {
+	d.changes = append(d.changes, changes...)
 }
 
 func (d *DummyDbMan) SetDbVersion(v string) {
@@ -33,14 +40,24 @@ func (d *DummyDbMan) GetDbVersion() string {
 	return d.version
 }
 
-func (d *DummyDbMan) GetKmsAttributes(tenantId string, entities ...string) map[string][]common.Attribute {
-	return nil
+func (d *DummyDbMan) GetKmsAttributes(tenantId string, entities ...string) (map[string][]common.Attribute, error) {
+	return nil, nil
 }
 
 type DummyCipherMan struct {
+	addedOrgs   []string
+	removedOrgs []string
 }
 
 func (c *DummyCipherMan) AddOrgs(orgs []string) {
+	c.addedOrgs = append(c.addedOrgs, orgs...)
+}
+
+func (c *DummyCipherMan) RemoveOrgs(orgs []string) {
+	c.removedOrgs = append(c.removedOrgs, orgs...)
+}
+
+func (c *DummyCipherMan) Close() {
 }
 
 func (d *DummyCipherMan) TryDecryptBase64(input string, org string) (string, error) {
@@ -50,3 +67,16 @@ func (d *DummyCipherMan) TryDecryptBase64(input string, org string) (string, err
 func (d *DummyCipherMan) EncryptBase64(input string, org string, mode cipher.Mode, padding cipher.Padding) (string, error) {
 	return input, nil
 }
+
+type DummyKeyStatusProvider struct {
+	statuses []common.KeyStatus
+	stats    common.KmsCipherStats
+}
+
+func (d *DummyKeyStatusProvider) KeyStatuses() []common.KeyStatus {
+	return d.statuses
+}
+
+func (d *DummyKeyStatusProvider) Stats() common.KmsCipherStats {
+	return d.stats
+}
@@ -16,24 +16,34 @@ package verifyApiKey
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apid/apid-core"
 	"github.com/apid/apid-core/util"
 	"github.com/apid/apidApiMetadata/common"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ApiManagerInterface interface {
 	InitAPI()
 	HandleRequest(w http.ResponseWriter, r *http.Request)
+	HandleBatchRequest(w http.ResponseWriter, r *http.Request)
 	verifyAPIKey(verifyApiKeyReq VerifyApiKeyRequest) (*VerifyApiKeySuccessResponse, *common.ErrorResponse)
 }
 
 type ApiManager struct {
 	DbMan             DbManagerInterface
 	VerifiersEndpoint string
-	apiInitialized    bool
+	// optional, nil disables caching of compiled resources
+	ResourceMatcher *common.ResourceMatcher
+	// optional, nil disables quota
+	Quota          *QuotaManager
+	apiInitialized bool
 }
 
 func (a *ApiManager) InitAPI() {
@@ -41,6 +51,7 @@ func (a *ApiManager) InitAPI() {
 		return
 	}
 	services.API().HandleFunc(a.VerifiersEndpoint, a.HandleRequest).Methods("POST")
+	services.API().HandleFunc(a.VerifiersEndpoint+BatchPath, a.HandleBatchRequest).Methods("POST")
 	a.apiInitialized = true
 	log.Debug("API endpoints initialized")
 }
@@ -64,13 +75,16 @@ func (a *ApiManager) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	verifyApiKeyResponse, errorResponse := a.verifyAPIKey(verifyApiKeyReq)
+	pin := a.DbMan.PinDb()
+	defer pin.Release()
+	w.Header().Set(common.HeaderDbVersion, pin.Version)
+	verifyApiKeyResponse, errorResponse := a.verifyAPIKeyInDb(pin.Db, pin.Version, verifyApiKeyReq)
 
 	if errorResponse != nil {
 		setResponseHeader(errorResponse, w)
 		returnValue = errorResponse
 	} else {
-		returnValue = verifyApiKeyResponse
+		returnValue = shapeAttributes(verifyApiKeyReq, verifyApiKeyResponse)
 	}
 	b, _ := json.Marshal(returnValue)
 	log.Debugf("handleVerifyAPIKey result %s", b)
@@ -78,6 +92,64 @@ func (a *ApiManager) HandleRequest(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// handle client batch API, all requests of a batch are verified against the same DB version
+func (a *ApiManager) HandleBatchRequest(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	rawReqs, err := validateBatchRequest(r.Body)
+	if err != nil {
+		errorResponse, jsonErr := json.Marshal(errorResponse("Bad_REQUEST", err.Error(), http.StatusBadRequest))
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(jsonErr.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errorResponse)
+		return
+	}
+
+	pin := a.DbMan.PinDb()
+	defer pin.Release()
+	w.Header().Set(common.HeaderDbVersion, pin.Version)
+	returnValues := make([]interface{}, len(rawReqs))
+	for i, rawReq := range rawReqs {
+		returnValues[i] = a.verifyBatchEntry(pin.Db, pin.Version, rawReq)
+	}
+	b, _ := json.Marshal(returnValues)
+	log.Debugf("handleVerifyAPIKey batch result %s", b)
+	w.Write(b)
+}
+
+// returns either the success response or the error response of a single batch entry
+func (apiM ApiManager) verifyBatchEntry(db apid.DB, dbVersion string, rawReq json.RawMessage) interface{} {
+	var verifyApiKeyReq VerifyApiKeyRequest
+	err := json.Unmarshal(rawReq, &verifyApiKeyReq)
+	if err == nil {
+		_, err = verifyApiKeyReq.validate()
+	}
+	if err != nil {
+		return errorResponse("Bad_REQUEST", err.Error(), http.StatusBadRequest)
+	}
+	verifyApiKeyResponse, errorResponse := apiM.verifyAPIKeyInDb(db, dbVersion, verifyApiKeyReq)
+	if errorResponse != nil {
+		return errorResponse
+	}
+	return shapeAttributes(verifyApiKeyReq, verifyApiKeyResponse)
+}
+
+// shapeAttributes formats the attributes of the response as requested, they have already been filtered
+func shapeAttributes(verifyApiKeyReq VerifyApiKeyRequest, response *VerifyApiKeySuccessResponse) interface{} {
+	shaped, err := verifyApiKeyReq.attributeOptions().ShapeResponse(response)
+	if err != nil {
+		// never happens for responses which can be marshalled
+		log.Errorf("Failed to format the attributes of the response: %v", err)
+		return response
+	}
+	return shaped
+}
+
 func setResponseHeader(errorResponse *common.ErrorResponse, w http.ResponseWriter) {
 	if errorResponse.StatusCode != 0 {
 		w.WriteHeader(errorResponse.StatusCode)
@@ -94,7 +166,6 @@ func validateRequest(requestBody io.ReadCloser, w http.ResponseWriter) (VerifyAp
 	if err != nil {
 		return verifyApiKeyReq, err
 	}
-	log.Debug("request body: ", string(body))
 	// 2. umarshall json to struct
 	err = json.Unmarshal(body, &verifyApiKeyReq)
 	if err != nil {
@@ -109,11 +180,38 @@ func validateRequest(requestBody io.ReadCloser, w http.ResponseWriter) (VerifyAp
 	return verifyApiKeyReq, nil
 }
 
+func validateBatchRequest(requestBody io.ReadCloser) ([]json.RawMessage, error) {
+	defer requestBody.Close()
+	body, err := ioutil.ReadAll(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	var rawReqs []json.RawMessage
+	if err = json.Unmarshal(body, &rawReqs); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(rawReqs) == 0:
+		return nil, errors.New("Empty batch")
+	case len(rawReqs) > MaxBatchSize:
+		return nil, fmt.Errorf("Batch size %d exceeds the maximum of %d", len(rawReqs), MaxBatchSize)
+	}
+	return rawReqs, nil
+}
+
 // returns []byte to be written to client
 func (apiM ApiManager) verifyAPIKey(verifyApiKeyReq VerifyApiKeyRequest) (*VerifyApiKeySuccessResponse, *common.ErrorResponse) {
+	pin := apiM.DbMan.PinDb()
+	defer pin.Release()
+	return apiM.verifyAPIKeyInDb(pin.Db, pin.Version, verifyApiKeyReq)
+}
+
+func (apiM ApiManager) verifyAPIKeyInDb(db apid.DB, dbVersion string, verifyApiKeyReq VerifyApiKeyRequest) (*VerifyApiKeySuccessResponse, *common.ErrorResponse) {
 
 	dataWrapper := VerifyApiKeyRequestResponseDataWrapper{
 		verifyApiKeyRequest: verifyApiKeyReq,
+		db:                  db,
+		dbVersion:           dbVersion,
 	}
 	dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientId = verifyApiKeyReq.Key
 	dataWrapper.verifyApiKeySuccessResponse.Environment = verifyApiKeyReq.EnvironmentName
@@ -134,15 +232,39 @@ func (apiM ApiManager) verifyAPIKey(verifyApiKeyReq VerifyApiKeyRequest) (*Verif
 		return nil, &errResponse
 	}
 
-	dataWrapper.verifyApiKeySuccessResponse.ApiProduct = shortListApiProduct(dataWrapper.apiProducts, verifyApiKeyReq)
+	if verifyApiKeyReq.Action == ActionVerifyClientCredentials {
+		if !secretMatches(verifyApiKeyReq.Secret, dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret) {
+			reason := "Client credentials verify failed for (" + verifyApiKeyReq.Key + ", " + verifyApiKeyReq.OrganizationName + ")"
+			errorCode := "oauth.v2.InvalidClientIdentifier"
+			errResponse := errorResponse(reason, errorCode, http.StatusOK)
+			return nil, &errResponse
+		}
+		dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret = ""
+	}
+
+	apiProduct, selection := selectApiProduct(apiM.ResourceMatcher, dbVersion, dataWrapper.apiProducts, verifyApiKeyReq)
+	dataWrapper.verifyApiKeySuccessResponse.ApiProduct = apiProduct
+	if verifyApiKeyReq.IncludeApiProductCandidates {
+		dataWrapper.verifyApiKeySuccessResponse.ApiProductSelection = selection
+	}
 	/*
 	 * Perform all validations
 	 */
 	errResponse := apiM.performValidations(dataWrapper)
+	if errResponse == nil {
+		errResponse = apiM.applyQuota(&dataWrapper)
+	}
 	if errResponse != nil {
+		if verifyApiKeyReq.IncludeApiProductCandidates {
+			errResponse.Details = selection
+		}
 		return nil, errResponse
 	}
 
+	dataWrapper.verifyApiKeySuccessResponse.Scopes = intersectScopes(
+		dataWrapper.verifyApiKeySuccessResponse.ClientId.Scopes,
+		dataWrapper.verifyApiKeySuccessResponse.ApiProduct.Scopes)
+
 	apiM.enrichAttributes(&dataWrapper)
 
 	setDevOrCompanyInResponseBasedOnCtype(dataWrapper.ctype, dataWrapper.tempDeveloperDetails, &dataWrapper.verifyApiKeySuccessResponse)
@@ -169,37 +291,80 @@ func setDevOrCompanyInResponseBasedOnCtype(ctype string, tempDeveloperDetails De
 }
 
 func shortListApiProduct(details []ApiProductDetails, verifyApiKeyReq VerifyApiKeyRequest) ApiProductDetails {
-	var bestMathcedProduct ApiProductDetails
-	rankedProducts := make([][]ApiProductDetails, 2)
-
-	for _, apiProd := range details {
-		if len(apiProd.Resources) == 0 || validatePath(apiProd.Resources, verifyApiKeyReq.UriPath) {
-			if len(apiProd.Apiproxies) == 0 || util.Contains(apiProd.Apiproxies, verifyApiKeyReq.ApiProxyName) {
-				if len(apiProd.Environments) == 0 || util.Contains(apiProd.Environments, verifyApiKeyReq.EnvironmentName) {
-					bestMathcedProduct = apiProd
-					return bestMathcedProduct
-					// set rank 1 or just return
-				} else {
-					// set rank to 2
-					rankedProducts[0] = append(rankedProducts[0], apiProd)
+	bestMathcedProduct, _ := selectApiProduct(nil, "", details, verifyApiKeyReq)
+	return bestMathcedProduct
+}
+
+// ranks of the candidates, from the best one
+var apiProductRanks = []struct {
+	desc  string
+	match func(c ApiProductCandidate) bool
+}{
+	{"resource, proxy and environment", func(c ApiProductCandidate) bool {
+		return c.ResourceMatched && c.ProxyMatched && c.EnvironmentMatched
+	}},
+	{"resource and proxy", func(c ApiProductCandidate) bool {
+		return c.ResourceMatched && c.ProxyMatched
+	}},
+	{"resource", func(c ApiProductCandidate) bool {
+		return c.ResourceMatched
+	}},
+}
+
+/*
+ * Selects the apiproduct of the best rank and explains the selection.
+ * Equally ranked apiproducts are ordered by name and id, whatever their order in details.
+ * An empty list of resources, proxies or environments matches anything.
+ */
+func selectApiProduct(matcher *common.ResourceMatcher, dbVersion string, details []ApiProductDetails, verifyApiKeyReq VerifyApiKeyRequest) (ApiProductDetails, *ApiProductSelection) {
+	selection := &ApiProductSelection{
+		Candidates: make([]ApiProductCandidate, len(details)),
+	}
+	for i, apiProd := range details {
+		_, resourceMatched := matcher.Match(dbVersion, apiProd.Id, apiProd.Resources, verifyApiKeyReq.UriPath)
+		selection.Candidates[i] = ApiProductCandidate{
+			Id:                 apiProd.Id,
+			Name:               apiProd.Name,
+			Resources:          apiProd.Resources,
+			Apiproxies:         apiProd.Apiproxies,
+			Environments:       apiProd.Environments,
+			ResourceMatched:    resourceMatched,
+			ProxyMatched:       len(apiProd.Apiproxies) == 0 || util.Contains(apiProd.Apiproxies, verifyApiKeyReq.ApiProxyName),
+			EnvironmentMatched: len(apiProd.Environments) == 0 || util.Contains(apiProd.Environments, verifyApiKeyReq.EnvironmentName),
+		}
+	}
+
+	for rank, r := range apiProductRanks {
+		selected, count := -1, 0
+		for i, candidate := range selection.Candidates {
+			if r.match(candidate) {
+				if selected < 0 || apiProductBefore(details[i], details[selected]) {
+					selected = i
 				}
-			} else {
-				// set rank to 3,
-				rankedProducts[1] = append(rankedProducts[1], apiProd)
+				count++
 			}
 		}
+		if selected < 0 {
+			continue
+		}
+		selection.Candidates[selected].Selected = true
+		selection.Reason = fmt.Sprintf("%s is the first by name of %d candidates matching the %s",
+			details[selected].Name, count, r.desc)
+		if rank > 0 {
+			selection.Reason = "No candidate matches the " + apiProductRanks[rank-1].desc + ", " + selection.Reason
+		}
+		return details[selected], selection
 	}
 
-	if len(rankedProducts[0]) > 0 {
-		return rankedProducts[0][0]
-	}
+	selection.Reason = fmt.Sprintf("None of the %d candidates matches the resource %s", len(details), verifyApiKeyReq.UriPath)
+	return ApiProductDetails{}, selection
+}
 
-	if len(rankedProducts[1]) > 0 {
-		return rankedProducts[1][0]
+func apiProductBefore(a, b ApiProductDetails) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
 	}
-
-	return bestMathcedProduct
-
+	return a.Id < b.Id
 }
 
 func (apiM ApiManager) performValidations(dataWrapper VerifyApiKeyRequestResponseDataWrapper) *common.ErrorResponse {
@@ -219,6 +384,12 @@ func (apiM ApiManager) performValidations(dataWrapper VerifyApiKeyRequestRespons
 		return &ee
 	}
 
+	if reason, errorCode = validateCredentialPeriod(clientIdDetails, time.Now()); reason != "" {
+		log.Debug("Validation error occoured ", errorCode, " ", reason)
+		ee := errorResponse(reason, errorCode, http.StatusOK)
+		return &ee
+	}
+
 	if !strings.EqualFold("APPROVED", appDetails.Status) {
 		reason = "API Key verify failed for (" + verifyApiKeyReq.Key + ", " + verifyApiKeyReq.OrganizationName + ")"
 		errorCode = "keymanagement.service.invalid_client-app_not_approved"
@@ -246,7 +417,7 @@ func (apiM ApiManager) performValidations(dataWrapper VerifyApiKeyRequestRespons
 		return &ee
 	}
 
-	result := len(apiProductDetails.Resources) == 0 || validatePath(apiProductDetails.Resources, verifyApiKeyReq.UriPath)
+	_, result := apiM.ResourceMatcher.Match(dataWrapper.dbVersion, apiProductDetails.Id, apiProductDetails.Resources, verifyApiKeyReq.UriPath)
 	if !result {
 		reason = "Path Validation Failed (" + strings.Join(apiProductDetails.Resources, ", ") + " vs " + verifyApiKeyReq.UriPath + ")"
 		errorCode = "oauth.v2.InvalidApiKeyForGivenResource"
@@ -271,18 +442,60 @@ func (apiM ApiManager) performValidations(dataWrapper VerifyApiKeyRequestRespons
 		return &ee
 	}
 
+	/* Verify the required scopes are granted to both the key and the product */
+	if len(verifyApiKeyReq.RequiredScopes) > 0 {
+		effectiveScopes := intersectScopes(clientIdDetails.Scopes, apiProductDetails.Scopes)
+		if missing := missingScopes(effectiveScopes, verifyApiKeyReq.RequiredScopes); len(missing) > 0 {
+			reason = "Scope Validation Failed (" + strings.Join(effectiveScopes, ", ") + " vs " + strings.Join(verifyApiKeyReq.RequiredScopes, ", ") + ")"
+			errorCode = "oauth.v2.InsufficientScope"
+			log.Debug("Validation error occoured ", errorCode, " ", reason)
+			ee := errorResponse(reason, errorCode, http.StatusOK)
+			return &ee
+		}
+	}
+
 	return nil
 
 }
 
+// applyQuota sets the quota usage in the response, counting the request if it enforces quota
+func (apiM ApiManager) applyQuota(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) *common.ErrorResponse {
+	verifyApiKeyReq := dataWrapper.verifyApiKeyRequest
+	apiProduct := &dataWrapper.verifyApiKeySuccessResponse.ApiProduct
+	appId := dataWrapper.verifyApiKeySuccessResponse.App.Id
+
+	usage, err := apiM.Quota.apply(verifyApiKeyReq.OrganizationName, appId, *apiProduct, verifyApiKeyReq.EnforceQuota, time.Now())
+	if err != nil {
+		// an unavailable counter does not block traffic
+		log.Errorf("Failed to apply quota of apiproduct %s for app %s: %v", apiProduct.Id, appId, err)
+		return nil
+	}
+	if usage == nil {
+		return nil
+	}
+	apiProduct.QuotaRemaining = &usage.Remaining
+	apiProduct.QuotaReset = usage.Reset.Format(time.RFC3339)
+
+	if usage.Exceeded {
+		reason := "Quota Validation Failed (" + strconv.FormatInt(usage.Limit, 10) + " per " +
+			strconv.FormatInt(apiProduct.QuotaInterval, 10) + " " + apiProduct.QuotaTimeunit + " for app " + appId + ")"
+		errorCode := "policies.ratelimit.QuotaViolation"
+		log.Debug("Validation error occoured ", errorCode, " ", reason)
+		ee := errorResponse(reason, errorCode, http.StatusOK)
+		return &ee
+	}
+	return nil
+}
+
 func (a *ApiManager) enrichAttributes(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) {
 
-	attributeMap := a.DbMan.GetKmsAttributes(dataWrapper.tenant_id, dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientId, dataWrapper.tempDeveloperDetails.Id, dataWrapper.verifyApiKeySuccessResponse.ApiProduct.Id, dataWrapper.verifyApiKeySuccessResponse.App.Id)
+	attributeMap := dataWrapper.attributes
+	opts := dataWrapper.verifyApiKeyRequest.attributeOptions()
 
-	clientIdAttributes := attributeMap[dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientId]
-	developerAttributes := attributeMap[dataWrapper.tempDeveloperDetails.Id]
-	appAttributes := attributeMap[dataWrapper.verifyApiKeySuccessResponse.App.Id]
-	apiProductAttributes := attributeMap[dataWrapper.verifyApiKeySuccessResponse.ApiProduct.Id]
+	clientIdAttributes := opts.FilterAttributes(attributeMap[dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientId])
+	developerAttributes := opts.FilterAttributes(attributeMap[dataWrapper.tempDeveloperDetails.Id])
+	appAttributes := opts.FilterAttributes(attributeMap[dataWrapper.verifyApiKeySuccessResponse.App.Id])
+	apiProductAttributes := opts.FilterAttributes(attributeMap[dataWrapper.verifyApiKeySuccessResponse.ApiProduct.Id])
 
 	dataWrapper.verifyApiKeySuccessResponse.ClientId.Attributes = clientIdAttributes
 	dataWrapper.verifyApiKeySuccessResponse.App.Attributes = appAttributes
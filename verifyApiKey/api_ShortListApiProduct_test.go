@@ -157,6 +157,73 @@ var _ = Describe("verifyApiKey_shortListApiProduct", func() {
 		})
 	})
 
+	Context("selectApiProduct tests", func() {
+		It("should explain a full match", func() {
+			req := VerifyApiKeyRequest{EnvironmentName: "test", ApiProxyName: "test-proxy", UriPath: "/this-is-my-path"}
+			dbData := []ApiProductDetails{
+				{Id: "api-product-1", Name: "p1", Environments: []string{"test"}, Apiproxies: []string{"test-proxy"}, Resources: []string{"/a/**"}},
+				{Id: "api-product-2", Name: "p2", Environments: []string{"test"}, Apiproxies: []string{"test-proxy"}, Resources: []string{"/**"}},
+				{Id: "api-product-3", Name: "p3", Environments: []string{}, Apiproxies: []string{}, Resources: []string{}},
+			}
+
+			actual, selection := selectApiProduct(nil, "", dbData, req)
+			Expect(actual.Id).Should(Equal("api-product-2"))
+			Expect(selection.Reason).Should(Equal("p2 is the first by name of 2 candidates matching the resource, proxy and environment"))
+			Expect(selection.Candidates).Should(Equal([]ApiProductCandidate{
+				{Id: "api-product-1", Name: "p1", Environments: []string{"test"}, Apiproxies: []string{"test-proxy"}, Resources: []string{"/a/**"},
+					ResourceMatched: false, ProxyMatched: true, EnvironmentMatched: true},
+				{Id: "api-product-2", Name: "p2", Environments: []string{"test"}, Apiproxies: []string{"test-proxy"}, Resources: []string{"/**"},
+					ResourceMatched: true, ProxyMatched: true, EnvironmentMatched: true, Selected: true},
+				{Id: "api-product-3", Name: "p3", Environments: []string{}, Apiproxies: []string{}, Resources: []string{},
+					ResourceMatched: true, ProxyMatched: true, EnvironmentMatched: true},
+			}))
+		})
+
+		It("should explain a fallback to a lower rank", func() {
+			req := VerifyApiKeyRequest{EnvironmentName: "stage", ApiProxyName: "other-proxy", UriPath: "/this-is-my-path"}
+			dbData := []ApiProductDetails{
+				{Id: "api-product-1", Name: "p1", Environments: []string{"test"}, Apiproxies: []string{"test-proxy"}, Resources: []string{"/**"}},
+			}
+
+			actual, selection := selectApiProduct(nil, "", dbData, req)
+			Expect(actual.Id).Should(Equal("api-product-1"))
+			Expect(selection.Reason).Should(Equal("No candidate matches the resource and proxy, p1 is the first by name of 1 candidates matching the resource"))
+			Expect(selection.Candidates[0].Selected).Should(BeTrue())
+			Expect(selection.Candidates[0].ProxyMatched).Should(BeFalse())
+			Expect(selection.Candidates[0].EnvironmentMatched).Should(BeFalse())
+		})
+
+		It("should select equally ranked products by name and id whatever their order", func() {
+			req := VerifyApiKeyRequest{EnvironmentName: "test", ApiProxyName: "test-proxy", UriPath: "/this-is-my-path"}
+			dbData := []ApiProductDetails{
+				{Id: "api-product-3", Name: "b", Resources: []string{"/**"}},
+				{Id: "api-product-2", Name: "a", Resources: []string{"/**"}},
+				{Id: "api-product-1", Name: "a", Resources: []string{"/**"}},
+			}
+
+			actual, selection := selectApiProduct(nil, "", dbData, req)
+			Expect(actual.Id).Should(Equal("api-product-1"))
+			Expect(selection.Reason).Should(Equal("a is the first by name of 3 candidates matching the resource, proxy and environment"))
+			Expect(selection.Candidates[2].Selected).Should(BeTrue())
+
+			reversed := []ApiProductDetails{dbData[2], dbData[1], dbData[0]}
+			actual, _ = selectApiProduct(nil, "", reversed, req)
+			Expect(actual.Id).Should(Equal("api-product-1"))
+		})
+
+		It("should explain why no product was selected", func() {
+			req := VerifyApiKeyRequest{EnvironmentName: "test", ApiProxyName: "test-proxy", UriPath: "/other"}
+			dbData := []ApiProductDetails{
+				{Id: "api-product-1", Name: "p1", Resources: []string{"/a/**"}},
+			}
+
+			actual, selection := selectApiProduct(nil, "", dbData, req)
+			Expect(actual.Id).Should(BeEmpty())
+			Expect(selection.Reason).Should(Equal("None of the 1 candidates matches the resource /other"))
+			Expect(selection.Candidates[0].Selected).Should(BeFalse())
+		})
+	})
+
 })
 
 type shortListApiProductTestDataStruct struct {
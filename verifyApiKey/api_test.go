@@ -72,8 +72,11 @@ var _ = Describe("end to end tests", func() {
 		}
 
 		testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			if req.URL.Path == ApiPath {
+			switch req.URL.Path {
+			case ApiPath:
 				apiMan.HandleRequest(w, req)
+			case ApiPath + BatchPath:
+				apiMan.HandleBatchRequest(w, req)
 			}
 		}))
 
@@ -137,6 +140,29 @@ var _ = Describe("end to end tests", func() {
 			Expect(respObj.ResponseMessage).Should(Equal("ENV Validation Failed (test vs prod)"))
 			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InvalidApiKeyForGivenResource"))
 		})
+		It("should report the DB version of the response", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			reqInput := VerifyApiKeyRequest{
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+			apiMan := ApiManager{DbMan: dbMan, VerifiersEndpoint: ApiPath}
+
+			w := httptest.NewRecorder()
+			apiMan.HandleRequest(w, httptest.NewRequest(http.MethodPost, ApiPath, strings.NewReader(string(jsonBody))))
+			Expect(w.Code).Should(Equal(http.StatusOK))
+			Expect(w.Header().Get(common.HeaderDbVersion)).Should(Equal(dataTestTempDir))
+
+			w = httptest.NewRecorder()
+			apiMan.HandleBatchRequest(w, httptest.NewRequest(http.MethodPost, ApiPath+BatchPath, strings.NewReader("["+string(jsonBody)+"]")))
+			Expect(w.Code).Should(Equal(http.StatusOK))
+			Expect(w.Header().Get(common.HeaderDbVersion)).Should(Equal(dataTestTempDir))
+		})
 		It("should return validation error for inavlid resource", func() {
 			setupApikeyDeveloperTestDb(dbMan.Db)
 			var respObj common.ErrorResponse
@@ -159,6 +185,38 @@ var _ = Describe("end to end tests", func() {
 			Expect(respObj.ResponseMessage).Should(Equal("Path Validation Failed. Product not resolved"))
 			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InvalidApiKeyForGivenResource"))
 		})
+		It("should explain the product selection on validation error", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			reqInput := VerifyApiKeyRequest{
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/google",
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+				IncludeApiProductCandidates:      true,
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			responseBody, err := performTestOperation(string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var respObj struct {
+				ResponseCode string              `json:"response_code"`
+				Details      ApiProductSelection `json:"details"`
+			}
+			json.Unmarshal(responseBody, &respObj)
+			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InvalidApiKeyForGivenResource"))
+			Expect(respObj.Details.Reason).Should(Equal("None of the 1 candidates matches the resource /google"))
+			Expect(len(respObj.Details.Candidates)).Should(Equal(1))
+			Expect(respObj.Details.Candidates[0].Id).Should(Equal("24987a63-edb9-4d6b-9334-87e1d70df8e3"))
+			Expect(respObj.Details.Candidates[0].Resources).Should(Equal([]string{"/zoho", "/twitter", "/nike"}))
+			Expect(respObj.Details.Candidates[0].ResourceMatched).Should(BeFalse())
+			Expect(respObj.Details.Candidates[0].ProxyMatched).Should(BeTrue())
+			Expect(respObj.Details.Candidates[0].EnvironmentMatched).Should(BeTrue())
+		})
 		It("should return validation error for inavlid proxies", func() {
 			setupApikeyDeveloperTestDb(dbMan.Db)
 			var respObj common.ErrorResponse
@@ -181,6 +239,80 @@ var _ = Describe("end to end tests", func() {
 			Expect(respObj.ResponseMessage).Should(Equal("Proxy Validation Failed (DevApplication, KeysApplication vs Invalid-proxy)"))
 			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InvalidApiKeyForGivenResource"))
 		})
+		It("should return validation error for insufficient scopes", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			var respObj common.ErrorResponse
+			reqInput := VerifyApiKeyRequest{
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+				RequiredScopes:   []string{"READ"},
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			responseBody, err := performTestOperation(string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			json.Unmarshal(responseBody, &respObj)
+			Expect(respObj.ResponseMessage).Should(Equal("Scope Validation Failed ( vs READ)"))
+			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InsufficientScope"))
+		})
+		It("should verify client credentials without returning the secret", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			reqInput := VerifyApiKeyRequest{
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				Secret:           "Ui8dcyGW3lA04YdX",
+				Action:           ActionVerifyClientCredentials,
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			responseBody, err := performTestOperation(string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(responseBody)).ShouldNot(ContainSubstring("Ui8dcyGW3lA04YdX"))
+
+			var respObj VerifyApiKeySuccessResponse
+			json.Unmarshal(responseBody, &respObj)
+			Expect(respObj.ClientId.ClientId).Should(Equal("63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0"))
+			Expect(respObj.ClientId.ClientSecret).Should(BeEmpty())
+			Expect(respObj.App.Id).Should(Equal("d371f05a-7c04-430c-b12d-26cf4e4d5d65"))
+		})
+		It("should return validation error for invalid client credentials", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			reqInput := VerifyApiKeyRequest{
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				Secret:           "wrong-secret",
+				Action:           ActionVerifyClientCredentials,
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				UriPath:          "/zoho",
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			responseBody, err := performTestOperation(string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var respObj common.ErrorResponse
+			json.Unmarshal(responseBody, &respObj)
+			Expect(respObj.ResponseMessage).Should(Equal("Client credentials verify failed for (63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0, apigee-mcrosrvc-client0001)"))
+			Expect(respObj.ResponseCode).Should(Equal("oauth.v2.InvalidClientIdentifier"))
+
+			reqInput.Secret = ""
+			jsonBody, _ = json.Marshal(reqInput)
+			responseBody, err = performTestOperation(string(jsonBody), 400)
+			Expect(err).ShouldNot(HaveOccurred())
+			json.Unmarshal(responseBody, &respObj)
+			Expect(respObj.ResponseCode).Should(Equal("Missing mandatory fields in the request : secret"))
+		})
 		It("should peform verify api key for developer happy path", func() {
 			setupApikeyDeveloperTestDb(dbMan.Db)
 			var respObj VerifyApiKeySuccessResponse
@@ -232,6 +364,51 @@ var _ = Describe("end to end tests", func() {
 
 		})
 
+		It("should return the selected attributes as an object", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+
+			reqInput := VerifyApiKeyRequest{
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+				Attributes:       []string{"Device"},
+				AttributesFormat: common.AttributesFormatMap,
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			responseBody, err := performTestOperation(string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var respObj struct {
+				ClientId struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"clientId"`
+				App map[string]interface{} `json:"app"`
+			}
+			Expect(json.Unmarshal(responseBody, &respObj)).Should(Succeed())
+			Expect(respObj.ClientId.Attributes).Should(Equal(map[string]interface{}{"Device": "ios"}))
+			Expect(respObj.App).ShouldNot(HaveKey("attributes"))
+		})
+
+		It("should reject an invalid attributes format", func() {
+			reqInput := VerifyApiKeyRequest{
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				UriPath:          "/zoho",
+				AttributesFormat: "xml",
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+
+			_, err := performTestOperation(string(jsonBody), 400)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
 		It("should peform verify api key for company happy path", func() {
 			setupApikeyCompanyTestDb(dbMan.Db)
 			var respObj VerifyApiKeySuccessResponse
@@ -283,11 +460,98 @@ var _ = Describe("end to end tests", func() {
 		})
 
 	})
+
+	Context("veriifyApiKey batch Api test ", func() {
+		It("should return results in request order", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			valid := VerifyApiKeyRequest{
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+			}
+			invalidKey := valid
+			invalidKey.Key = "invalid-key"
+			missingFields := VerifyApiKeyRequest{
+				Key: "test",
+			}
+			jsonBody, _ := json.Marshal([]VerifyApiKeyRequest{invalidKey, valid, missingFields})
+
+			responseBody, err := performTestOperationAtPath(ApiPath+BatchPath, string(jsonBody), 200)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var rawResults []json.RawMessage
+			Expect(json.Unmarshal(responseBody, &rawResults)).Should(Succeed())
+			Expect(len(rawResults)).Should(Equal(3))
+
+			var errObj common.ErrorResponse
+			Expect(json.Unmarshal(rawResults[0], &errObj)).Should(Succeed())
+			Expect(errObj.ResponseCode).Should(Equal("oauth.v2.InvalidApiKey"))
+
+			var respObj VerifyApiKeySuccessResponse
+			Expect(json.Unmarshal(rawResults[1], &respObj)).Should(Succeed())
+			Expect(respObj.ClientId.ClientId).Should(Equal("63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0"))
+			Expect(respObj.ApiProduct.Id).Should(Equal("24987a63-edb9-4d6b-9334-87e1d70df8e3"))
+
+			errObj = common.ErrorResponse{}
+			Expect(json.Unmarshal(rawResults[2], &errObj)).Should(Succeed())
+			Expect(errObj.ResponseMessage).Should(Equal("Bad_REQUEST"))
+			Expect(errObj.ResponseCode).Should(Equal("Missing mandatory fields in the request : action organizationName uriPath"))
+		})
+
+		It("should reject malformed batches", func() {
+			for _, body := range []string{"[]", "{}", "not json"} {
+				responseBody, err := performTestOperationAtPath(ApiPath+BatchPath, body, 400)
+				Expect(err).ShouldNot(HaveOccurred())
+				var respObj common.ErrorResponse
+				Expect(json.Unmarshal(responseBody, &respObj)).Should(Succeed())
+				Expect(respObj.ResponseMessage).Should(Equal("Bad_REQUEST"))
+			}
+
+			reqs := make([]VerifyApiKeyRequest, MaxBatchSize+1)
+			jsonBody, _ := json.Marshal(reqs)
+			_, err := performTestOperationAtPath(ApiPath+BatchPath, string(jsonBody), 400)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should keep verifying against the pinned DB version", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			apiMan := ApiManager{DbMan: dbMan}
+			db, dbVersion := dbMan.GetDbAndVersion()
+
+			newVersionDir, err := ioutil.TempDir(testTempDirBase, "api_test_sqlite3")
+			Expect(err).NotTo(HaveOccurred())
+			dbMan.SetDbVersion(newVersionDir)
+
+			reqInput := VerifyApiKeyRequest{
+				Action:           "verify",
+				OrganizationName: "apigee-mcrosrvc-client0001",
+				Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				EnvironmentName:  "test",
+				ApiProxyName:     "DevApplication",
+				UriPath:          "/zoho",
+
+				ValidateAgainstApiProxiesAndEnvs: true,
+			}
+			jsonBody, _ := json.Marshal(reqInput)
+			result := apiMan.verifyBatchEntry(db, dbVersion, jsonBody)
+			Expect(result).Should(BeAssignableToTypeOf(&VerifyApiKeySuccessResponse{}))
+			Expect(result.(*VerifyApiKeySuccessResponse).App.Id).Should(Equal("d371f05a-7c04-430c-b12d-26cf4e4d5d65"))
+		})
+	})
 })
 
 func performTestOperation(jsonBody string, expectedResponseCode int) ([]byte, error) {
+	return performTestOperationAtPath(ApiPath, jsonBody, expectedResponseCode)
+}
+
+func performTestOperationAtPath(path string, jsonBody string, expectedResponseCode int) ([]byte, error) {
 	uri, err := url.Parse(testServer.URL)
-	uri.Path = ApiPath
+	uri.Path = path
 	client := &http.Client{}
 	httpReq, err := http.NewRequest("POST", uri.String(), strings.NewReader(string(jsonBody)))
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -0,0 +1,263 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	"container/list"
+	"github.com/apid/apidApiMetadata/common"
+	tran "github.com/apigee-labs/transicator/common"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheSize = 10000
+	DefaultCacheTTL  = 5 * time.Minute
+)
+
+// columns identifying the cached entities touched by a change, by table
+var cacheInvalidationColumns = map[string]string{
+	"kms_app_credential":                   "id",
+	"kms_app":                              "id",
+	"kms_developer":                        "id",
+	"kms_company":                          "id",
+	"kms_api_product":                      "id",
+	"kms_attributes":                       "entity_id",
+	"kms_app_credential_apiproduct_mapper": "appcred_id",
+}
+
+// changes to this table may affect any cached key
+const tableOrganization = "kms_organization"
+
+// CreateApiKeyCache creates a bounded LRU cache of api key details.
+// Entries expire after ttl. A size of 0 disables the cache.
+func CreateApiKeyCache(size int, ttl time.Duration) *ApiKeyCache {
+	if size <= 0 {
+		return nil
+	}
+	return &ApiKeyCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[apiKeyCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// ApiKeyCache holds the DB lookup results of verify api key per (org, key).
+// A nil *ApiKeyCache is valid and caches nothing.
+type ApiKeyCache struct {
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[apiKeyCacheKey]*list.Element
+	// front is the most recently used
+	lru *list.List
+	// incremented on every invalidation, so that lookups started
+	// before an invalidation are not cached afterwards
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+type ApiKeyCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+type apiKeyCacheKey struct {
+	org string
+	key string
+}
+
+type apiKeyCacheEntry struct {
+	key apiKeyCacheKey
+	// version of the DB the details were read from
+	dbVersion string
+	details   *apiKeyDetails
+	expiresAt time.Time
+}
+
+// everything getApiKeyDetails reads from the DB for a key
+type apiKeyDetails struct {
+	ctype       string
+	tenantId    string
+	clientId    ClientIdDetails
+	developer   DeveloperDetails
+	app         AppDetails
+	apiProducts []ApiProductDetails
+	attributes  map[string][]common.Attribute
+}
+
+func newApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) *apiKeyDetails {
+	return &apiKeyDetails{
+		ctype:       dataWrapper.ctype,
+		tenantId:    dataWrapper.tenant_id,
+		clientId:    dataWrapper.verifyApiKeySuccessResponse.ClientId,
+		developer:   dataWrapper.tempDeveloperDetails,
+		app:         dataWrapper.verifyApiKeySuccessResponse.App,
+		apiProducts: dataWrapper.apiProducts,
+		attributes:  dataWrapper.attributes,
+	}
+}
+
+func (d *apiKeyDetails) copyTo(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) {
+	dataWrapper.ctype = d.ctype
+	dataWrapper.tenant_id = d.tenantId
+	dataWrapper.verifyApiKeySuccessResponse.ClientId = d.clientId
+	dataWrapper.tempDeveloperDetails = d.developer
+	dataWrapper.verifyApiKeySuccessResponse.App = d.app
+	dataWrapper.apiProducts = d.apiProducts
+	dataWrapper.attributes = d.attributes
+}
+
+// whether any of the cached entities has one of the given ids
+func (d *apiKeyDetails) references(ids map[string]bool) bool {
+	if ids[d.developer.Id] || ids[d.app.Id] {
+		return true
+	}
+	for _, prod := range d.apiProducts {
+		if ids[prod.Id] {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns nil unless the entry was read from the given DB version
+func (c *ApiKeyCache) get(org, key, dbVersion string) *apiKeyDetails {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e := c.entries[apiKeyCacheKey{org, key}]; e != nil {
+		entry := e.Value.(*apiKeyCacheEntry)
+		switch {
+		case !time.Now().Before(entry.expiresAt):
+			c.remove(e)
+		case entry.dbVersion == dbVersion:
+			c.lru.MoveToFront(e)
+			c.hits++
+			return entry.details
+		}
+	}
+	c.misses++
+	return nil
+}
+
+// returns the generation to be passed to put for the lookup about to start
+func (c *ApiKeyCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// put is a no-op if the cache was invalidated since generation was taken
+func (c *ApiKeyCache) put(org, key, dbVersion string, details *apiKeyDetails, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation {
+		return
+	}
+	k := apiKeyCacheKey{org, key}
+	if e := c.entries[k]; e != nil {
+		c.remove(e)
+	}
+	c.entries[k] = c.lru.PushFront(&apiKeyCacheEntry{
+		key:       k,
+		dbVersion: dbVersion,
+		details:   details,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// must be called with mutex held
+func (c *ApiKeyCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*apiKeyCacheEntry).key)
+}
+
+// Flush drops all cached entries.
+func (c *ApiKeyCache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.entries = make(map[apiKeyCacheKey]*list.Element)
+	c.lru.Init()
+}
+
+// Invalidate drops the cached entries referring to any row touched by the changes.
+func (c *ApiKeyCache) Invalidate(changes []tran.Change) {
+	if c == nil {
+		return
+	}
+	ids := make(map[string]bool)
+	for _, change := range changes {
+		table := common.NormalizeTableName(change.Table)
+		if table == tableOrganization {
+			c.Flush()
+			return
+		}
+		column, ok := cacheInvalidationColumns[table]
+		if !ok {
+			continue
+		}
+		for _, row := range []tran.Row{change.OldRow, change.NewRow} {
+			var id string
+			if row != nil && row.Get(column, &id) == nil && id != "" {
+				ids[id] = true
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*apiKeyCacheEntry); ids[entry.key.key] || entry.details.references(ids) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// Stats returns the hit/miss counters and the current number of entries.
+func (c *ApiKeyCache) Stats() ApiKeyCacheStats {
+	if c == nil {
+		return ApiKeyCacheStats{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return ApiKeyCacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Size:   c.lru.Len(),
+	}
+}
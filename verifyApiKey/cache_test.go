@@ -0,0 +1,129 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	tran "github.com/apigee-labs/transicator/common"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("ApiKeyCache", func() {
+	var cache *ApiKeyCache
+	testDetails := func(key string) *apiKeyDetails {
+		return &apiKeyDetails{
+			clientId:    ClientIdDetails{ClientId: key},
+			developer:   DeveloperDetails{Id: "dev-" + key},
+			app:         AppDetails{Id: "app-" + key},
+			apiProducts: []ApiProductDetails{{Id: "prod-" + key}},
+		}
+	}
+	idRow := func(column, id string) tran.Row {
+		return tran.Row{
+			column: &tran.ColumnVal{Value: id},
+		}
+	}
+
+	BeforeEach(func() {
+		cache = CreateApiKeyCache(2, time.Minute)
+	})
+
+	It("should be disabled for size 0", func() {
+		cache = CreateApiKeyCache(0, time.Minute)
+		Expect(cache).Should(BeNil())
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+		cache.Flush()
+		Expect(cache.Stats()).Should(Equal(ApiKeyCacheStats{}))
+	})
+
+	It("should count hits and misses", func() {
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		Expect(cache.get("org", "key1", "v1")).Should(Equal(testDetails("key1")))
+		Expect(cache.get("org1", "key1", "v1")).Should(BeNil())
+		Expect(cache.Stats()).Should(Equal(ApiKeyCacheStats{Hits: 1, Misses: 2, Size: 1}))
+	})
+
+	It("should miss entries read from another DB version", func() {
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		Expect(cache.get("org", "key1", "v2")).Should(BeNil())
+		Expect(cache.get("org", "key1", "v1")).ShouldNot(BeNil())
+	})
+
+	It("should evict least recently used entries", func() {
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		cache.put("org", "key2", "v1", testDetails("key2"), cache.currentGeneration())
+		Expect(cache.get("org", "key1", "v1")).ShouldNot(BeNil())
+		cache.put("org", "key3", "v1", testDetails("key3"), cache.currentGeneration())
+		Expect(cache.get("org", "key2", "v1")).Should(BeNil())
+		Expect(cache.get("org", "key1", "v1")).ShouldNot(BeNil())
+		Expect(cache.get("org", "key3", "v1")).ShouldNot(BeNil())
+	})
+
+	It("should expire entries", func() {
+		cache = CreateApiKeyCache(2, 10*time.Millisecond)
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		Expect(cache.get("org", "key1", "v1")).ShouldNot(BeNil())
+		time.Sleep(20 * time.Millisecond)
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+		Expect(cache.Stats().Size).Should(BeZero())
+	})
+
+	It("should flush", func() {
+		generation := cache.currentGeneration()
+		cache.put("org", "key1", "v1", testDetails("key1"), generation)
+		cache.Flush()
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+		// lookups started before the flush should not be cached
+		cache.put("org", "key1", "v1", testDetails("key1"), generation)
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+	})
+
+	It("should invalidate entries by changed rows", func() {
+		testData := []tran.Change{
+			{Table: "kms.app_credential", OldRow: idRow("id", "key1")},
+			{Table: "kms.developer", NewRow: idRow("id", "dev-key1")},
+			{Table: "kms.app", NewRow: idRow("id", "app-key1")},
+			{Table: "kms.api_product", OldRow: idRow("id", "prod-key1")},
+			{Table: "kms.attributes", NewRow: idRow("entity_id", "prod-key1")},
+			{Table: "kms.app_credential_apiproduct_mapper", NewRow: idRow("appcred_id", "key1")},
+		}
+		for _, change := range testData {
+			cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+			cache.put("org", "key2", "v1", testDetails("key2"), cache.currentGeneration())
+			cache.Invalidate([]tran.Change{change})
+			Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+			Expect(cache.get("org", "key2", "v1")).ShouldNot(BeNil())
+		}
+	})
+
+	It("should ignore unrelated changes", func() {
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		cache.Invalidate([]tran.Change{
+			{Table: "kms.company_developer", NewRow: idRow("developer_id", "dev-key1")},
+			{Table: "edgex.data_scope", NewRow: idRow("id", "key1")},
+		})
+		Expect(cache.get("org", "key1", "v1")).ShouldNot(BeNil())
+	})
+
+	It("should flush for organization changes", func() {
+		cache.put("org", "key1", "v1", testDetails("key1"), cache.currentGeneration())
+		cache.Invalidate([]tran.Change{
+			{Table: "kms.organization", NewRow: idRow("id", "org")},
+		})
+		Expect(cache.get("org", "key1", "v1")).Should(BeNil())
+	})
+})
@@ -15,21 +15,57 @@ package verifyApiKey
 
 import (
 	"errors"
+	"github.com/apid/apid-core"
 	"github.com/apid/apidApiMetadata/common"
+	tran "github.com/apigee-labs/transicator/common"
 )
 
 type DbManagerInterface interface {
 	common.DbManagerInterface
+	GetDbAndVersion() (apid.DB, string)
+	PinDb() *common.DbPin
 	getApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) error
 }
 
 type DbManager struct {
 	common.DbManager
+	// optional, nil disables caching
+	Cache *ApiKeyCache
 }
 
+func (dbc *DbManager) SetDbVersion(version string) {
+	dbc.DbManager.SetDbVersion(version)
+	log.Debugf("Flushing api key cache, stats: %+v", dbc.Cache.Stats())
+	dbc.Cache.Flush()
+}
+
+func (dbc *DbManager) InvalidateCache(changes []tran.Change) {
+	dbc.Cache.Invalidate(changes)
+}
+
+// getApiKeyDetails reads from the DB pinned in the dataWrapper, pinning the current one if none is.
 func (dbc *DbManager) getApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) error {
+	if dataWrapper.db == nil {
+		dataWrapper.db, dataWrapper.dbVersion = dbc.GetDbAndVersion()
+	}
+	org := dataWrapper.verifyApiKeyRequest.OrganizationName
+	key := dataWrapper.verifyApiKeyRequest.Key
+	if details := dbc.Cache.get(org, key, dataWrapper.dbVersion); details != nil {
+		details.copyTo(dataWrapper)
+		return nil
+	}
+	generation := dbc.Cache.currentGeneration()
+	if err := dbc.queryApiKeyDetails(dataWrapper); err != nil {
+		return err
+	}
+	dbc.Cache.put(org, key, dataWrapper.dbVersion, newApiKeyDetails(dataWrapper), generation)
+	return nil
+}
+
+func (dbc *DbManager) queryApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseDataWrapper) error {
 
-	db := dbc.Db
+	db := dataWrapper.db
+	var scopes string
 
 	err := db.QueryRow(sql_GET_API_KEY_DETAILS_SQL, dataWrapper.verifyApiKeyRequest.Key, dataWrapper.verifyApiKeyRequest.OrganizationName).
 		Scan(
@@ -37,6 +73,9 @@ func (dbc *DbManager) getApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseD
 			&dataWrapper.tenant_id,
 			&dataWrapper.verifyApiKeySuccessResponse.ClientId.Status,
 			&dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret,
+			&dataWrapper.verifyApiKeySuccessResponse.ClientId.IssuedAt,
+			&dataWrapper.verifyApiKeySuccessResponse.ClientId.ExpiresAt,
+			&scopes,
 
 			&dataWrapper.tempDeveloperDetails.Id,
 			&dataWrapper.tempDeveloperDetails.UserName,
@@ -74,23 +113,38 @@ func (dbc *DbManager) getApiKeyDetails(dataWrapper *VerifyApiKeyRequestResponseD
 		return err
 	}
 	dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret = secret
+	dataWrapper.verifyApiKeySuccessResponse.ClientId.Scopes = common.JsonToStringArray(scopes)
 
 	if dataWrapper.verifyApiKeySuccessResponse.App.CallbackUrl != "" {
 		dataWrapper.verifyApiKeySuccessResponse.ClientId.RedirectURIs = []string{dataWrapper.verifyApiKeySuccessResponse.App.CallbackUrl}
 	}
 
-	dataWrapper.apiProducts = dbc.getApiProductsForApiKey(dataWrapper.verifyApiKeyRequest.Key, dataWrapper.tenant_id)
+	dataWrapper.apiProducts = dbc.getApiProductsForApiKey(db, dataWrapper.verifyApiKeyRequest.Key, dataWrapper.tenant_id)
+
+	// attributes of all products are fetched, as the product is resolved per request
+	entities := []string{
+		dataWrapper.verifyApiKeyRequest.Key,
+		dataWrapper.tempDeveloperDetails.Id,
+		dataWrapper.verifyApiKeySuccessResponse.App.Id,
+	}
+	for _, prod := range dataWrapper.apiProducts {
+		entities = append(entities, prod.Id)
+	}
+	dataWrapper.attributes, err = common.QueryKmsAttributes(db, dataWrapper.tenant_id, entities...)
+	if err != nil {
+		return err
+	}
 
-	log.Debug("dataWrapper : ", dataWrapper)
+	// the dataWrapper holds the decrypted secret, only the request is logged
+	log.Debug("api key details fetched for ", dataWrapper.verifyApiKeyRequest)
 
 	return err
 }
 
-func (dbc *DbManager) getApiProductsForApiKey(key, tenantId string) []ApiProductDetails {
+func (dbc *DbManager) getApiProductsForApiKey(db apid.DB, key, tenantId string) []ApiProductDetails {
 
-	db := dbc.Db
 	allProducts := []ApiProductDetails{}
-	var proxies, environments, resources string
+	var proxies, environments, resources, scopes string
 
 	rows, err := db.Query(sql_GET_API_PRODUCTS_FOR_KEY_SQL, key, tenantId)
 	defer rows.Close()
@@ -115,10 +169,12 @@ func (dbc *DbManager) getApiProductsForApiKey(key, tenantId string) []ApiProduct
 			&proxies,
 			&environments,
 			&resources,
+			&scopes,
 		)
 		apiProductDetais.Apiproxies = common.JsonToStringArray(proxies)
 		apiProductDetais.Environments = common.JsonToStringArray(environments)
 		apiProductDetais.Resources = common.JsonToStringArray(resources)
+		apiProductDetais.Scopes = common.JsonToStringArray(scopes)
 
 		allProducts = append(allProducts, apiProductDetais)
 	}
@@ -17,10 +17,12 @@ import (
 	"github.com/apid/apid-core"
 	"github.com/apid/apid-core/factory"
 	"github.com/apid/apidApiMetadata/common"
+	tran "github.com/apigee-labs/transicator/common"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"io/ioutil"
 	"sync"
+	"time"
 )
 
 var _ = Describe("DataTest", func() {
@@ -65,6 +67,9 @@ var _ = Describe("DataTest", func() {
 			Expect(dataWrapper.tenant_id).Should(BeEquivalentTo("bc811169"))
 			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.Status).Should(BeEquivalentTo("APPROVED"))
 			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret).Should(BeEquivalentTo("Ui8dcyGW3lA04YdX"))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.IssuedAt).Should(BeEquivalentTo("2017-08-07 17:00:54.258+00:00"))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.ExpiresAt).Should(BeEquivalentTo(""))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.Scopes).Should(BeEquivalentTo([]string{"DELETE"}))
 
 			Expect(dataWrapper.tempDeveloperDetails.Id).Should(BeEquivalentTo("7834c683-9453-4389-b816-34ca24dfccd9"))
 			Expect(dataWrapper.tempDeveloperDetails.UserName).Should(BeEquivalentTo("East India Company"))
@@ -108,6 +113,9 @@ var _ = Describe("DataTest", func() {
 			Expect(dataWrapper.tenant_id).Should(BeEquivalentTo("bc811169"))
 			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.Status).Should(BeEquivalentTo("APPROVED"))
 			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.ClientSecret).Should(BeEquivalentTo("Ui8dcyGW3lA04YdX"))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.IssuedAt).Should(BeEquivalentTo("2017-08-07 17:00:54.258+00:00"))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.ExpiresAt).Should(BeEquivalentTo(""))
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ClientId.Scopes).Should(BeEquivalentTo([]string{"DELETE"}))
 
 			Expect(dataWrapper.tempDeveloperDetails.Id).Should(BeEquivalentTo("209ffd18-37e9-4a67-9e30-a5c40a534b6c"))
 			Expect(dataWrapper.tempDeveloperDetails.UserName).Should(BeEquivalentTo("wilson"))
@@ -135,6 +143,73 @@ var _ = Describe("DataTest", func() {
 
 		})
 
+		It("should get attributes of all related entities", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+
+			dataWrapper := VerifyApiKeyRequestResponseDataWrapper{
+				verifyApiKeyRequest: VerifyApiKeyRequest{
+					OrganizationName: "apigee-mcrosrvc-client0001",
+					Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				},
+			}
+			Expect(dbMan.getApiKeyDetails(&dataWrapper)).Should(Succeed())
+			Expect(dataWrapper.attributes).Should(HaveLen(2))
+			Expect(dataWrapper.attributes["63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0"]).Should(Equal([]common.Attribute{{Name: "Device", Value: "ios"}}))
+			Expect(dataWrapper.attributes["d371f05a-7c04-430c-b12d-26cf4e4d5d65"]).Should(Equal([]common.Attribute{{Name: "Company", Value: "Apple"}}))
+		})
+
+		It("should serve api key details from cache until invalidated", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			dbMan.Cache = CreateApiKeyCache(DefaultCacheSize, DefaultCacheTTL)
+			newDataWrapper := func() VerifyApiKeyRequestResponseDataWrapper {
+				return VerifyApiKeyRequestResponseDataWrapper{
+					verifyApiKeyRequest: VerifyApiKeyRequest{
+						OrganizationName: "apigee-mcrosrvc-client0001",
+						Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+					},
+				}
+			}
+
+			dataWrapper := newDataWrapper()
+			Expect(dbMan.getApiKeyDetails(&dataWrapper)).Should(Succeed())
+			_, err := dbMan.Db.Exec(`DELETE FROM kms_app_credential WHERE id='63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0'`)
+			Expect(err).Should(Succeed())
+
+			cached := newDataWrapper()
+			Expect(dbMan.getApiKeyDetails(&cached)).Should(Succeed())
+			Expect(cached).Should(Equal(dataWrapper))
+			Expect(dbMan.Cache.Stats()).Should(Equal(ApiKeyCacheStats{Hits: 1, Misses: 1, Size: 1}))
+
+			dbMan.InvalidateCache([]tran.Change{
+				{
+					Operation: tran.Delete,
+					Table:     "kms.app_credential",
+					OldRow: tran.Row{
+						"id": &tran.ColumnVal{Value: "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0"},
+					},
+				},
+			})
+			invalidated := newDataWrapper()
+			err = dbMan.getApiKeyDetails(&invalidated)
+			Expect(err).ShouldNot(Succeed())
+			Expect(err.Error()).Should(Equal("InvalidApiKey"))
+		})
+
+		It("should flush cache when switching db version", func() {
+			setupApikeyDeveloperTestDb(dbMan.Db)
+			dbMan.Cache = CreateApiKeyCache(DefaultCacheSize, time.Hour)
+			dataWrapper := VerifyApiKeyRequestResponseDataWrapper{
+				verifyApiKeyRequest: VerifyApiKeyRequest{
+					OrganizationName: "apigee-mcrosrvc-client0001",
+					Key:              "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0",
+				},
+			}
+			Expect(dbMan.getApiKeyDetails(&dataWrapper)).Should(Succeed())
+			Expect(dbMan.Cache.Stats().Size).Should(Equal(1))
+			dbMan.SetDbVersion(dataTestTempDir)
+			Expect(dbMan.Cache.Stats().Size).Should(BeZero())
+		})
+
 		It("should throw error when apikey not found", func() {
 
 			setupApikeyCompanyTestDb(dbMan.Db)
@@ -153,7 +228,7 @@ var _ = Describe("DataTest", func() {
 
 			setupApikeyCompanyTestDb(dbMan.Db)
 
-			apiProducts := dbMan.getApiProductsForApiKey("63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0", "bc811169")
+			apiProducts := dbMan.getApiProductsForApiKey(dbMan.GetDb(), "63tHSNLKJkcc6GENVWGT1Zw5gek7kVJ0", "bc811169")
 			Expect(len(apiProducts)).Should(BeEquivalentTo(1))
 
 			Expect(apiProducts[0].Id).Should(BeEquivalentTo("24987a63-edb9-4d6b-9334-87e1d70df8e3"))
@@ -166,6 +241,7 @@ var _ = Describe("DataTest", func() {
 
 			Expect(apiProducts[0].Resources).Should(BeEquivalentTo([]string{"/zoho", "/twitter", "/nike"}))
 			Expect(apiProducts[0].Apiproxies).Should(BeEquivalentTo([]string{"DevApplication", "KeysApplication"}))
+			Expect(apiProducts[0].Scopes).Should(BeEquivalentTo([]string{"READ", "WRITE"}))
 			Expect(apiProducts[0].Environments).Should(BeEquivalentTo([]string{"test"}))
 			Expect(apiProducts[0].Company).Should(BeEquivalentTo(""))
 			Expect(len(apiProducts[0].Attributes)).Should(BeEquivalentTo(0))
@@ -180,7 +256,7 @@ var _ = Describe("DataTest", func() {
 		It("should return empty array when no api products found", func() {
 
 			setupApikeyCompanyTestDb(dbMan.Db)
-			apiProducts := dbMan.getApiProductsForApiKey("invalid-LKJkcc6GENVWGT1Zw5gek7kVJ0", "bc811169")
+			apiProducts := dbMan.getApiProductsForApiKey(dbMan.GetDb(), "invalid-LKJkcc6GENVWGT1Zw5gek7kVJ0", "bc811169")
 			Expect(len(apiProducts)).Should(BeEquivalentTo(0))
 
 		})
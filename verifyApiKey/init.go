@@ -18,7 +18,14 @@ import (
 )
 
 const (
-	ApiPath = "/verifiers/apikey"
+	ApiPath   = "/verifiers/apikey"
+	BatchPath = "/batch"
+	// maximum number of requests in a batch
+	MaxBatchSize = 100
+
+	ActionVerify = "verify"
+	// verifies the secret along with the key, the secret is not returned
+	ActionVerifyClientCredentials = "verifyClientCredentials"
 )
 
 var (
@@ -21,6 +21,12 @@ type DummyCipherMan struct {
 func (c *DummyCipherMan) AddOrgs(orgs []string) {
 }
 
+func (c *DummyCipherMan) RemoveOrgs(orgs []string) {
+}
+
+func (c *DummyCipherMan) Close() {
+}
+
 func (d *DummyCipherMan) TryDecryptBase64(input string, org string) (string, error) {
 	return input, nil
 }
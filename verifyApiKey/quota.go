@@ -0,0 +1,263 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// counts reset at the end of each calendar aligned window
+	QuotaWindowFixed = "fixed"
+	// counts cover the last interval before each request
+	QuotaWindowRolling = "rolling"
+)
+
+// how often expired counts are dropped by the in-memory counter
+const quotaPurgeInterval = time.Minute
+
+// QuotaKey identifies the quota of an app for an apiproduct
+type QuotaKey struct {
+	Org          string
+	AppId        string
+	ApiProductId string
+}
+
+// QuotaCounter holds the request counts of quota windows.
+// Implementations must be safe for concurrent use, so that a store shared
+// by several apid instances can be plugged in.
+type QuotaCounter interface {
+	// Add adds delta to the count of key in the window starting at start, and returns the new count.
+	// A delta of 0 only reads the count. The count may be dropped after expiresAt.
+	Add(key QuotaKey, start, expiresAt time.Time, delta int64) (int64, error)
+}
+
+// QuotaUsage is the state of a quota after a request
+type QuotaUsage struct {
+	Limit     int64
+	Remaining int64
+	// time at which the quota allows requests again
+	Reset    time.Time
+	Exceeded bool
+}
+
+/*
+ * QuotaManager applies the quota of apiproducts, defined by their quota limit,
+ * interval and time unit (minute, hour, day or month), per app.
+ * Fixed windows are aligned on UTC calendar boundaries.
+ * Rolling windows are approximated from the counts of the current and previous fixed windows,
+ * the previous count being weighted by its overlap with the rolling window.
+ * Requests over the limit are not counted, so that rejected requests do not keep the quota exceeded.
+ * A nil *QuotaManager is valid and applies no quota.
+ */
+type QuotaManager struct {
+	Counter QuotaCounter
+	// QuotaWindowFixed or QuotaWindowRolling
+	Window string
+}
+
+func CreateQuotaManager(counter QuotaCounter, window string) *QuotaManager {
+	return &QuotaManager{
+		Counter: counter,
+		Window:  window,
+	}
+}
+
+/*
+ * apply returns the usage of the quota of the app for the apiproduct, or nil if the apiproduct has none.
+ * The request is only counted if enforce is true and it is within the limit,
+ * the usage being exceeded otherwise.
+ */
+func (q *QuotaManager) apply(org, appId string, product ApiProductDetails, enforce bool, now time.Time) (*QuotaUsage, error) {
+	if q == nil || q.Counter == nil {
+		return nil, nil
+	}
+	limit, interval, timeunit, ok := productQuota(product)
+	if !ok {
+		return nil, nil
+	}
+	key := QuotaKey{Org: org, AppId: appId, ApiProductId: product.Id}
+	start, end := quotaWindow(interval, timeunit, now)
+	rolling := q.Window == QuotaWindowRolling
+
+	var delta int64
+	if enforce {
+		delta = 1
+	}
+	expiresAt := end
+	if rolling {
+		// the count is still needed as the previous one in the next window
+		expiresAt = end.Add(end.Sub(start))
+	}
+	count, err := q.Counter.Add(key, start, expiresAt, delta)
+	if err != nil {
+		return nil, err
+	}
+	var prevCount int64
+	if rolling {
+		prevStart, _ := quotaWindow(interval, timeunit, start.Add(-time.Nanosecond))
+		if prevCount, err = q.Counter.Add(key, prevStart, expiresAt, 0); err != nil {
+			return nil, err
+		}
+	}
+	// weight of the previous count in the rolling window
+	prevWeight := float64(end.Sub(now)) / float64(end.Sub(start))
+	used := float64(count) + float64(prevCount)*prevWeight
+
+	usage := &QuotaUsage{
+		Limit:    limit,
+		Reset:    end,
+		Exceeded: enforce && used > float64(limit),
+	}
+	if usage.Exceeded {
+		if _, err = q.Counter.Add(key, start, expiresAt, -1); err != nil {
+			return nil, err
+		}
+		count--
+		used--
+	}
+	if rolling {
+		usage.Reset = rollingReset(limit, count, prevCount, start, end, usage.Exceeded)
+	}
+	if remaining := limit - int64(math.Ceil(used)); remaining > 0 {
+		usage.Remaining = remaining
+	}
+	return usage, nil
+}
+
+/*
+ * rollingReset returns the Reset of a rolling window from the counts of its current and previous fixed windows.
+ * The previous count stops weighing at the end of the current window, and the current count at the end of the next one.
+ * If the quota is exceeded, this is when enough of the oldest counted requests have left the window for one more
+ * request, otherwise when the oldest counted requests have all left it.
+ */
+func rollingReset(limit, count, prevCount int64, start, end time.Time, exceeded bool) time.Time {
+	length := float64(end.Sub(start))
+	switch {
+	case !exceeded && prevCount > 0:
+		return end
+	case !exceeded && count > 0:
+		return end.Add(end.Sub(start))
+	case !exceeded:
+		return end
+	case count < limit && prevCount > 0:
+		// the previous count weighs prevCount*(end-t)/length at t
+		return end.Add(-time.Duration(float64(limit-1-count) * length / float64(prevCount)))
+	default:
+		// in the next window, the current count weighs count*(end+length-t)/length at t
+		return end.Add(end.Sub(start)).Add(-time.Duration(float64(limit-1) * length / float64(count)))
+	}
+}
+
+// productQuota returns the quota of the apiproduct, if it defines a valid one
+func productQuota(product ApiProductDetails) (limit, interval int64, timeunit string, ok bool) {
+	limit, err := strconv.ParseInt(strings.TrimSpace(product.QuotaLimit), 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, 0, "", false
+	}
+	timeunit = strings.ToLower(strings.TrimSpace(product.QuotaTimeunit))
+	switch timeunit {
+	case "minute", "hour", "day", "month":
+	default:
+		log.Debugf("Ignoring quota of apiproduct %s with time unit %s", product.Id, product.QuotaTimeunit)
+		return 0, 0, "", false
+	}
+	interval = product.QuotaInterval
+	if interval <= 0 {
+		interval = 1
+	}
+	return limit, interval, timeunit, true
+}
+
+// quotaWindow returns the boundaries of the fixed window containing t
+func quotaWindow(interval int64, timeunit string, t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	var unit time.Duration
+	switch timeunit {
+	case "month":
+		months := int64(t.Year()-1970)*12 + int64(t.Month()) - 1
+		months -= months % interval
+		start = time.Date(1970, time.Month(months+1), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, int(interval), 0)
+	case "day":
+		unit = 24 * time.Hour
+	case "hour":
+		unit = time.Hour
+	default:
+		unit = time.Minute
+	}
+	length := time.Duration(interval) * unit
+	start = t.Truncate(length)
+	return start, start.Add(length)
+}
+
+// InMemoryQuotaCounter is a QuotaCounter local to this apid instance
+type InMemoryQuotaCounter struct {
+	mutex     sync.Mutex
+	counts    map[quotaCountKey]*quotaCount
+	nextPurge time.Time
+}
+
+type quotaCountKey struct {
+	QuotaKey
+	start int64
+}
+
+type quotaCount struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func CreateInMemoryQuotaCounter() *InMemoryQuotaCounter {
+	return &InMemoryQuotaCounter{
+		counts: make(map[quotaCountKey]*quotaCount),
+	}
+}
+
+func (c *InMemoryQuotaCounter) Add(key QuotaKey, start, expiresAt time.Time, delta int64) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.purge(time.Now())
+	k := quotaCountKey{QuotaKey: key, start: start.UnixNano()}
+	entry := c.counts[k]
+	if entry == nil {
+		if delta == 0 {
+			return 0, nil
+		}
+		entry = &quotaCount{}
+		c.counts[k] = entry
+	}
+	entry.count += delta
+	if expiresAt.After(entry.expiresAt) {
+		entry.expiresAt = expiresAt
+	}
+	return entry.count, nil
+}
+
+// must be called with the mutex held
+func (c *InMemoryQuotaCounter) purge(now time.Time) {
+	if now.Before(c.nextPurge) {
+		return
+	}
+	for k, entry := range c.counts {
+		if now.After(entry.expiresAt) {
+			delete(c.counts, k)
+		}
+	}
+	c.nextPurge = now.Add(quotaPurgeInterval)
+}
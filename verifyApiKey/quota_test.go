@@ -0,0 +1,220 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Quota", func() {
+	product := ApiProductDetails{Id: "p1", QuotaLimit: "3", QuotaInterval: 1, QuotaTimeunit: "minute"}
+
+	Context("Windows", func() {
+		It("should align fixed windows on UTC boundaries", func() {
+			t := time.Date(2017, time.August, 17, 13, 47, 31, 0, time.UTC)
+			testData := []struct {
+				interval int64
+				timeunit string
+				start    time.Time
+				end      time.Time
+			}{
+				{1, "minute", time.Date(2017, 8, 17, 13, 47, 0, 0, time.UTC), time.Date(2017, 8, 17, 13, 48, 0, 0, time.UTC)},
+				{15, "minute", time.Date(2017, 8, 17, 13, 45, 0, 0, time.UTC), time.Date(2017, 8, 17, 14, 0, 0, 0, time.UTC)},
+				{1, "hour", time.Date(2017, 8, 17, 13, 0, 0, 0, time.UTC), time.Date(2017, 8, 17, 14, 0, 0, 0, time.UTC)},
+				{1, "day", time.Date(2017, 8, 17, 0, 0, 0, 0, time.UTC), time.Date(2017, 8, 18, 0, 0, 0, 0, time.UTC)},
+				{1, "month", time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)},
+				{3, "month", time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)},
+			}
+			for _, td := range testData {
+				start, end := quotaWindow(td.interval, td.timeunit, t.In(time.FixedZone("PDT", -7*3600)))
+				Expect(start).Should(Equal(td.start), td.timeunit)
+				Expect(end).Should(Equal(td.end), td.timeunit)
+			}
+		})
+
+		It("should ignore invalid quota", func() {
+			for _, p := range []ApiProductDetails{
+				{QuotaLimit: "", QuotaInterval: 1, QuotaTimeunit: "minute"},
+				{QuotaLimit: "abc", QuotaInterval: 1, QuotaTimeunit: "minute"},
+				{QuotaLimit: "0", QuotaInterval: 1, QuotaTimeunit: "minute"},
+				{QuotaLimit: "10", QuotaInterval: 1, QuotaTimeunit: "week"},
+			} {
+				_, _, _, ok := productQuota(p)
+				Expect(ok).Should(BeFalse())
+			}
+			limit, interval, timeunit, ok := productQuota(ApiProductDetails{QuotaLimit: "10", QuotaTimeunit: "Hour"})
+			Expect(ok).Should(BeTrue())
+			Expect([]interface{}{limit, interval, timeunit}).Should(Equal([]interface{}{int64(10), int64(1), "hour"}))
+		})
+	})
+
+	Context("QuotaManager", func() {
+		var now time.Time
+
+		BeforeEach(func() {
+			now = time.Now().UTC().Truncate(time.Minute).Add(15 * time.Second)
+		})
+
+		It("should apply no quota if nil", func() {
+			var q *QuotaManager
+			usage, err := q.apply("org", "app", product, true, now)
+			Expect(err).Should(Succeed())
+			Expect(usage).Should(BeNil())
+		})
+
+		It("should only count enforced requests in fixed windows", func() {
+			q := CreateQuotaManager(CreateInMemoryQuotaCounter(), QuotaWindowFixed)
+			usage, err := q.apply("org", "app", product, false, now)
+			Expect(err).Should(Succeed())
+			Expect(*usage).Should(Equal(QuotaUsage{Limit: 3, Remaining: 3, Reset: now.Truncate(time.Minute).Add(time.Minute)}))
+
+			for i := 2; i >= 0; i-- {
+				usage, err = q.apply("org", "app", product, true, now)
+				Expect(err).Should(Succeed())
+				Expect(usage.Remaining).Should(Equal(int64(i)))
+				Expect(usage.Exceeded).Should(BeFalse())
+			}
+			usage, err = q.apply("org", "app", product, true, now)
+			Expect(err).Should(Succeed())
+			Expect(usage.Exceeded).Should(BeTrue())
+
+			// rejected requests are not counted
+			start := now.Truncate(time.Minute)
+			count, err := q.Counter.Add(QuotaKey{Org: "org", AppId: "app", ApiProductId: "p1"}, start, start.Add(time.Minute), 0)
+			Expect(err).Should(Succeed())
+			Expect(count).Should(Equal(int64(3)))
+
+			// other apps and windows are counted apart
+			usage, err = q.apply("org", "app2", product, true, now)
+			Expect(err).Should(Succeed())
+			Expect(usage.Remaining).Should(Equal(int64(2)))
+			usage, err = q.apply("org", "app", product, true, now.Add(time.Minute))
+			Expect(err).Should(Succeed())
+			Expect(usage.Remaining).Should(Equal(int64(2)))
+		})
+
+		It("should weight the previous window in rolling windows", func() {
+			q := CreateQuotaManager(CreateInMemoryQuotaCounter(), QuotaWindowRolling)
+			start := now.Truncate(time.Minute)
+			var usage *QuotaUsage
+			var err error
+			for i := 0; i < 3; i++ {
+				usage, err = q.apply("org", "app", product, true, now)
+				Expect(err).Should(Succeed())
+			}
+			// the requests leave the rolling window by the end of the next one
+			Expect(usage.Reset).Should(Equal(start.Add(2 * time.Minute)))
+
+			// 3 requests weighted by the remaining 3/4 of the previous window
+			usage, err = q.apply("org", "app", product, true, now.Add(time.Minute))
+			Expect(err).Should(Succeed())
+			Expect(usage.Exceeded).Should(BeTrue())
+			Expect(usage.Remaining).Should(BeZero())
+			// once weighted by 2/3, one more request fits
+			Expect(usage.Reset).Should(Equal(start.Add(80 * time.Second)))
+
+			// weighted by 1/2 only, the rejected request not being counted
+			usage, err = q.apply("org", "app", product, false, now.Add(75*time.Second))
+			Expect(err).Should(Succeed())
+			Expect(usage.Exceeded).Should(BeFalse())
+			Expect(usage.Remaining).Should(Equal(int64(1)))
+			Expect(usage.Reset).Should(Equal(start.Add(2 * time.Minute)))
+		})
+
+		It("should reset rolling windows when the current requests leave them", func() {
+			q := CreateQuotaManager(CreateInMemoryQuotaCounter(), QuotaWindowRolling)
+			start := now.Truncate(time.Minute)
+			for i := 0; i < 3; i++ {
+				_, err := q.apply("org", "app", product, true, now)
+				Expect(err).Should(Succeed())
+			}
+			usage, err := q.apply("org", "app", product, true, now)
+			Expect(err).Should(Succeed())
+			Expect(usage.Exceeded).Should(BeTrue())
+			// the 3 requests weigh 2 at 20s into the next window
+			Expect(usage.Reset).Should(Equal(start.Add(80 * time.Second)))
+
+			usage, err = q.apply("org", "app", product, true, start.Add(80*time.Second))
+			Expect(err).Should(Succeed())
+			Expect(usage.Exceeded).Should(BeFalse())
+		})
+
+		It("should return counter errors", func() {
+			q := CreateQuotaManager(failingQuotaCounter{}, QuotaWindowFixed)
+			_, err := q.apply("org", "app", product, true, now)
+			Expect(err).ShouldNot(Succeed())
+		})
+	})
+
+	Context("applyQuota", func() {
+		var dataWrapper VerifyApiKeyRequestResponseDataWrapper
+
+		BeforeEach(func() {
+			dataWrapper = VerifyApiKeyRequestResponseDataWrapper{
+				verifyApiKeyRequest: VerifyApiKeyRequest{OrganizationName: "org", EnforceQuota: true},
+			}
+			dataWrapper.verifyApiKeySuccessResponse.App.Id = "app"
+			dataWrapper.verifyApiKeySuccessResponse.ApiProduct = product
+		})
+
+		It("should set the usage and reject exceeded quota", func() {
+			a := ApiManager{Quota: CreateQuotaManager(CreateInMemoryQuotaCounter(), QuotaWindowFixed)}
+			for i := 0; i < 3; i++ {
+				Expect(a.applyQuota(&dataWrapper)).Should(BeNil())
+			}
+			Expect(*dataWrapper.verifyApiKeySuccessResponse.ApiProduct.QuotaRemaining).Should(BeZero())
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ApiProduct.QuotaReset).ShouldNot(BeEmpty())
+
+			errResponse := a.applyQuota(&dataWrapper)
+			Expect(errResponse).ShouldNot(BeNil())
+			Expect(errResponse.ResponseCode).Should(Equal("policies.ratelimit.QuotaViolation"))
+			Expect(errResponse.ResponseMessage).Should(Equal("Quota Validation Failed (3 per 1 minute for app app)"))
+		})
+
+		It("should not block requests if the counter fails", func() {
+			a := ApiManager{Quota: CreateQuotaManager(failingQuotaCounter{}, QuotaWindowFixed)}
+			Expect(a.applyQuota(&dataWrapper)).Should(BeNil())
+			Expect(dataWrapper.verifyApiKeySuccessResponse.ApiProduct.QuotaRemaining).Should(BeNil())
+		})
+	})
+
+	Context("InMemoryQuotaCounter", func() {
+		It("should drop expired counts", func() {
+			c := CreateInMemoryQuotaCounter()
+			key := QuotaKey{Org: "org", AppId: "app", ApiProductId: "p1"}
+			start := time.Now()
+			count, err := c.Add(key, start, start.Add(-time.Second), 2)
+			Expect(err).Should(Succeed())
+			Expect(count).Should(Equal(int64(2)))
+			count, err = c.Add(key, start, start.Add(-time.Second), 0)
+			Expect(err).Should(Succeed())
+			Expect(count).Should(Equal(int64(2)))
+
+			c.nextPurge = time.Time{}
+			count, err = c.Add(key, start, start.Add(-time.Second), 0)
+			Expect(err).Should(Succeed())
+			Expect(count).Should(BeZero())
+			Expect(c.counts).Should(BeEmpty())
+		})
+	})
+})
+
+type failingQuotaCounter struct{}
+
+func (failingQuotaCounter) Add(QuotaKey, time.Time, time.Time, int64) (int64, error) {
+	return 0, errors.New("counter unavailable")
+}
@@ -20,6 +20,9 @@ const sql_GET_API_KEY_DETAILS_SQL = `
 
 				COALESCE(c.status,""),
 				COALESCE(c.consumer_secret,""),
+				COALESCE(c.issued_at,""),
+				COALESCE(c.expires_at,""),
+				COALESCE(c.scopes,""),
 
 				COALESCE(ad.id,"") as dev_id,
 				COALESCE(ad.username,"") as dev_username,
@@ -67,6 +70,9 @@ const sql_GET_API_KEY_DETAILS_SQL = `
 
 				COALESCE(c.status,""),
 				COALESCE(c.consumer_secret,""),
+				COALESCE(c.issued_at,""),
+				COALESCE(c.expires_at,""),
+				COALESCE(c.scopes,""),
 
 				COALESCE(ad.id,"") as dev_id,
 				COALESCE(ad.display_name,"") as dev_username,
@@ -123,7 +129,8 @@ const sql_GET_API_PRODUCTS_FOR_KEY_SQL = `
 				COALESCE(ap.updated_by,"") as prod_updated_by,
 				COALESCE(ap.proxies,"") as prod_proxies,
 				COALESCE(ap.environments,"") as prod_environments,
-				COALESCE(ap.api_resources,"") as prod_resources
+				COALESCE(ap.api_resources,"") as prod_resources,
+				COALESCE(ap.scopes,"") as prod_scopes
 			FROM
 				KMS_APP_CREDENTIAL AS c
 				INNER JOIN KMS_APP_CREDENTIAL_APIPRODUCT_MAPPER as mp
@@ -137,6 +144,7 @@ const sql_GET_API_PRODUCTS_FOR_KEY_SQL = `
 				AND c.id = $1
 				AND ap.tenant_id = $2
 				)
+			ORDER BY ap.name, ap.id
 		;`
 
 const sql_GET_KMS_ATTRIBUTES_FOR_TENANT = "select entity_id, name, value from kms_attributes where tenant_id = $1"
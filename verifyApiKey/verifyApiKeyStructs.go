@@ -15,6 +15,8 @@ package verifyApiKey
 
 import (
 	"errors"
+	"fmt"
+	"github.com/apid/apid-core"
 	"github.com/apid/apidApiMetadata/common"
 )
 
@@ -23,6 +25,12 @@ type ClientIdDetails struct {
 	ClientSecret string   `json:"clientSecret,omitempty"`
 	RedirectURIs []string `json:"redirectURIs,omitempty"`
 	Status       string   `json:"status,omitempty"`
+	// time from which the client Id is valid
+	IssuedAt string `json:"issuedAt,omitempty"`
+	// time after which the client Id is no longer valid, empty or -1 if it never expires
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// scopes granted to the client Id
+	Scopes []string `json:"scopes,omitempty"`
 	// Attributes associated with the client Id.
 	Attributes []common.Attribute `json:"attributes,omitempty"`
 }
@@ -42,11 +50,36 @@ type ApiProductDetails struct {
 	Company        string   `json:"company,omitempty"`
 	Environments   []string `json:"environments,omitempty"`
 	Apiproxies     []string `json:"apiproxies,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+	// only set if a quota counter is configured and the apiproduct has a quota
+	QuotaRemaining *int64 `json:"quota.remaining,omitempty"`
+	// RFC 3339 time at which the quota allows requests again
+	QuotaReset string `json:"quota.reset,omitempty"`
 	// Attributes associated with the apiproduct.
 	Attributes []common.Attribute `json:"attributes,omitempty"`
 	Resources  []string           `json:"-"`
 }
 
+// how the apiproduct was selected among the ones of the key
+type ApiProductSelection struct {
+	Candidates []ApiProductCandidate `json:"candidates"`
+	// why the apiproduct was selected, or why none was
+	Reason string `json:"reason"`
+}
+
+// match of an apiproduct of the key against the request
+type ApiProductCandidate struct {
+	Id                 string   `json:"id"`
+	Name               string   `json:"name"`
+	Resources          []string `json:"resources,omitempty"`
+	Apiproxies         []string `json:"apiproxies,omitempty"`
+	Environments       []string `json:"environments,omitempty"`
+	ResourceMatched    bool     `json:"resourceMatched"`
+	ProxyMatched       bool     `json:"proxyMatched"`
+	EnvironmentMatched bool     `json:"environmentMatched"`
+	Selected           bool     `json:"selected"`
+}
+
 type AppDetails struct {
 	Id             string   `json:"id,omitempty"`
 	Name           string   `json:"name,omitempty"`
@@ -105,6 +138,31 @@ type VerifyApiKeyRequest struct {
 	ApiProxyName     string `json:"apiProxyName"`
 	// when this flag is false, authentication of key and authorization for uripath is done and authorization for apiproxies and environments is skipped. Default is true.
 	ValidateAgainstApiProxiesAndEnvs bool `json:"validateAgainstApiProxiesAndEnvs,omitempty"`
+	// optional, scopes which the key must have been granted for the resolved apiproduct
+	RequiredScopes []string `json:"requiredScopes,omitempty"`
+	// consumer secret to be verified along with the key, mandatory for ActionVerifyClientCredentials
+	Secret string `json:"secret,omitempty"`
+	// when this flag is true, the response explains how the apiproduct was selected among all candidates
+	IncludeApiProductCandidates bool `json:"includeApiProductCandidates,omitempty"`
+	// when this flag is true, the request is counted against the quota of the apiproduct, and rejected once the quota is exceeded
+	EnforceQuota bool `json:"enforceQuota,omitempty"`
+	// optional, names of the attributes to return, all of them if empty
+	Attributes []string `json:"attributes,omitempty"`
+	// optional, format of the attributes: common.AttributesFormatList (default) or common.AttributesFormatMap
+	AttributesFormat string `json:"attributesFormat,omitempty"`
+	// when this flag is true, attributes holding JSON objects, arrays, numbers or booleans are returned decoded
+	TypedAttributes bool `json:"typedAttributes,omitempty"`
+}
+
+// fields of VerifyApiKeyRequest, without its String method
+type verifyApiKeyRequestFields VerifyApiKeyRequest
+
+// String redacts the secret, so that requests can be logged
+func (v VerifyApiKeyRequest) String() string {
+	if v.Secret != "" {
+		v.Secret = "********"
+	}
+	return fmt.Sprintf("%+v", verifyApiKeyRequestFields(v))
 }
 
 func (v *VerifyApiKeyRequest) validate() (bool, error) {
@@ -114,6 +172,10 @@ func (v *VerifyApiKeyRequest) validate() (bool, error) {
 		validationMsg += " action"
 	}
 
+	if v.Action == ActionVerifyClientCredentials && v.Secret == "" {
+		validationMsg += " secret"
+	}
+
 	if v.Key == "" {
 		validationMsg += " key"
 	}
@@ -136,9 +198,20 @@ func (v *VerifyApiKeyRequest) validate() (bool, error) {
 		validationMsg = "Missing mandatory fields in the request :" + validationMsg
 		return false, errors.New(validationMsg)
 	}
+	if err := v.attributeOptions().Validate(); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+func (v *VerifyApiKeyRequest) attributeOptions() *common.AttributeOptions {
+	return &common.AttributeOptions{
+		Names:  v.Attributes,
+		Format: v.AttributesFormat,
+		Typed:  v.TypedAttributes,
+	}
+}
+
 type VerifyApiKeySuccessResponse struct {
 	Self string `json:"self,omitempty"`
 	// Organization Identifier/Name
@@ -150,6 +223,10 @@ type VerifyApiKeySuccessResponse struct {
 	Company     CompanyDetails    `json:"company,omitempty"`
 	App         AppDetails        `json:"app,omitempty"`
 	ApiProduct  ApiProductDetails `json:"apiProduct,omitempty"`
+	// scopes granted to both the client Id and the apiproduct
+	Scopes []string `json:"scopes,omitempty"`
+	// only set if IncludeApiProductCandidates was requested
+	ApiProductSelection *ApiProductSelection `json:"apiProductSelection,omitempty"`
 	// Identifier of the authorization code. This will be unique for each request.
 	Identifier string `json:"identifier,omitempty"`
 	Kind       string `json:"kind,omitempty"`
@@ -160,6 +237,11 @@ type VerifyApiKeyRequestResponseDataWrapper struct {
 	verifyApiKeySuccessResponse VerifyApiKeySuccessResponse
 	tempDeveloperDetails        DeveloperDetails
 	apiProducts                 []ApiProductDetails
-	ctype                       string
-	tenant_id                   string
+	// kms attributes by entity id
+	attributes map[string][]common.Attribute
+	ctype      string
+	tenant_id  string
+	// DB all lookups of the request are run against, and its version
+	db        apid.DB
+	dbVersion string
 }
@@ -15,41 +15,108 @@
 package verifyApiKey
 
 import (
-	"regexp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/apid/apid-core/util"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// error codes of credentials outside of their validity period
+const (
+	errorCodeApiKeyExpired     = "oauth.v2.ApiKeyExpired"
+	errorCodeApiKeyNotYetValid = "oauth.v2.ApiKeyNotYetValid"
+	// the validity period of the credential cannot be parsed
+	errorCodeInvalidApiKey = "oauth.v2.InvalidApiKey"
+)
+
+// layouts of the timestamps stored in the kms tables
+var kmsTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+}
+
+/*
+ * Compares the secrets in constant time. Digests are compared
+ * so that the length of the expected secret is not leaked either.
+ * An empty expected secret never matches.
+ */
+func secretMatches(secret, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	secretDigest := sha256.Sum256([]byte(secret))
+	expectedDigest := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(secretDigest[:], expectedDigest[:]) == 1
+}
+
+// scopes present in both lists, in the order of the first one
+func intersectScopes(scopes, other []string) []string {
+	var result []string
+	for _, scope := range scopes {
+		if util.Contains(other, scope) && !util.Contains(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// required scopes not present in the granted ones
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !util.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
 /*
- * Check for the base path (API_Product) match with the path
- * received in the Request, via the customized regex, where
- * "**" gets de-normalized as ".*" and "*" as everything till
- * the next "/".
+ * Parses a kms timestamp, either formatted or in epoch millis.
+ * Empty values and -1, used for credentials which never expire,
+ * yield the zero time.
  */
-func validatePath(fs []string, requestBase string) bool {
-
-	for _, a := range fs {
-		str1 := strings.Replace(a, "**", "(.*)", -1)
-		str2 := strings.Replace(a, "*", "([^/]+)", -1)
-		if a != str1 {
-			reg, _ := regexp.Compile(str1)
-			res := reg.MatchString(requestBase)
-			if res == true {
-				return true
-			}
-		} else if a != str2 {
-			reg, _ := regexp.Compile(str2)
-			res := reg.MatchString(requestBase)
-			if res == true {
-				return true
-			}
-		} else if requestBase == a {
-			return true
+func parseKmsTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-1" {
+		return time.Time{}, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	}
+	var err error
+	for _, layout := range kmsTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
 		}
+	}
+	return time.Time{}, err
+}
 
-		/*
-		 * FIXME: SINGLE_FORWARD_SLASH_PATTERN not supported yet
-		 */
+/*
+ * Checks that now is within the validity period of the credential.
+ * Returns the reason and the error code of the failure, or empty strings if valid.
+ * Unparsable timestamps fail the check with errorCodeInvalidApiKey.
+ */
+func validateCredentialPeriod(clientId ClientIdDetails, now time.Time) (reason, errorCode string) {
+	issuedAt, err := parseKmsTime(clientId.IssuedAt)
+	if err != nil {
+		return "API Key has an invalid issue time (" + clientId.IssuedAt + ")", errorCodeInvalidApiKey
+	}
+	expiresAt, err := parseKmsTime(clientId.ExpiresAt)
+	if err != nil {
+		return "API Key has an invalid expiry time (" + clientId.ExpiresAt + ")", errorCodeInvalidApiKey
+	}
+	if !issuedAt.IsZero() && now.Before(issuedAt) {
+		return "API Key is not valid before " + clientId.IssuedAt, errorCodeApiKeyNotYetValid
+	}
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return "API Key expired at " + clientId.ExpiresAt, errorCodeApiKeyExpired
 	}
-	/* if the i/p resource is empty, no checks need to be made */
-	return len(fs) == 0
+	return "", ""
 }
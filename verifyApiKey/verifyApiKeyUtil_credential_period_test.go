@@ -0,0 +1,76 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Validate Credential Period", func() {
+	now := time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	It("should parse kms timestamps", func() {
+		for _, value := range []string{
+			"2017-08-07 17:00:54.258+00:00",
+			"2017-08-07T17:00:54.258Z",
+			"2017-08-07 17:00:54.258",
+			"1502125254258",
+		} {
+			t, err := parseKmsTime(value)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(t.Equal(time.Date(2017, 8, 7, 17, 0, 54, 258000000, time.UTC))).Should(BeTrue(), value)
+		}
+	})
+
+	It("should treat empty and -1 as unbounded", func() {
+		for _, value := range []string{"", "-1"} {
+			t, err := parseKmsTime(value)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(t.IsZero()).Should(BeTrue())
+		}
+		reason, errorCode := validateCredentialPeriod(ClientIdDetails{ExpiresAt: "-1"}, now)
+		Expect(reason).Should(BeEmpty())
+		Expect(errorCode).Should(BeEmpty())
+	})
+
+	It("should accept credentials within their validity period", func() {
+		clientId := ClientIdDetails{
+			IssuedAt:  "2017-08-07 17:00:54.258+00:00",
+			ExpiresAt: "2017-10-07 17:00:54.258+00:00",
+		}
+		reason, errorCode := validateCredentialPeriod(clientId, now)
+		Expect(reason).Should(BeEmpty())
+		Expect(errorCode).Should(BeEmpty())
+	})
+
+	It("should reject expired and not yet valid credentials", func() {
+		reason, errorCode := validateCredentialPeriod(ClientIdDetails{ExpiresAt: "2017-09-01 00:00:00.000+00:00"}, now)
+		Expect(reason).Should(Equal("API Key expired at 2017-09-01 00:00:00.000+00:00"))
+		Expect(errorCode).Should(Equal(errorCodeApiKeyExpired))
+		reason, errorCode = validateCredentialPeriod(ClientIdDetails{IssuedAt: "2017-09-02 00:00:00.000+00:00"}, now)
+		Expect(reason).Should(Equal("API Key is not valid before 2017-09-02 00:00:00.000+00:00"))
+		Expect(errorCode).Should(Equal(errorCodeApiKeyNotYetValid))
+	})
+
+	It("should reject unparsable timestamps", func() {
+		reason, errorCode := validateCredentialPeriod(ClientIdDetails{ExpiresAt: "tomorrow"}, now)
+		Expect(reason).Should(Equal("API Key has an invalid expiry time (tomorrow)"))
+		Expect(errorCode).Should(Equal(errorCodeInvalidApiKey))
+		reason, errorCode = validateCredentialPeriod(ClientIdDetails{IssuedAt: "yesterday"}, now)
+		Expect(reason).Should(Equal("API Key has an invalid issue time (yesterday)"))
+		Expect(errorCode).Should(Equal(errorCodeInvalidApiKey))
+	})
+})
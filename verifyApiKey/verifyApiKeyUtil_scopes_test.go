@@ -0,0 +1,35 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scopes", func() {
+
+	It("should intersect scopes in order without duplicates", func() {
+		Expect(intersectScopes([]string{"WRITE", "READ", "WRITE"}, []string{"READ", "WRITE", "DELETE"})).
+			Should(Equal([]string{"WRITE", "READ"}))
+		Expect(intersectScopes([]string{"READ"}, nil)).Should(BeEmpty())
+		Expect(intersectScopes(nil, []string{"READ"})).Should(BeEmpty())
+	})
+
+	It("should find missing scopes", func() {
+		Expect(missingScopes([]string{"READ", "WRITE"}, []string{"READ"})).Should(BeEmpty())
+		Expect(missingScopes([]string{"READ"}, []string{"READ", "WRITE", "DELETE"})).
+			Should(Equal([]string{"WRITE", "DELETE"}))
+	})
+})
@@ -0,0 +1,42 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package verifyApiKey
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client Secret", func() {
+
+	It("should match equal secrets only", func() {
+		Expect(secretMatches("secret", "secret")).Should(BeTrue())
+		Expect(secretMatches("secret", "Secret")).Should(BeFalse())
+		Expect(secretMatches("secret", "secret1")).Should(BeFalse())
+		Expect(secretMatches("", "secret")).Should(BeFalse())
+		Expect(secretMatches("", "")).Should(BeFalse())
+	})
+
+	It("should redact the secret when logging requests", func() {
+		req := VerifyApiKeyRequest{
+			Action: ActionVerifyClientCredentials,
+			Key:    "key",
+			Secret: "secret",
+		}
+		Expect(fmt.Sprint(req)).ShouldNot(ContainSubstring("secret"))
+		Expect(fmt.Sprint(req)).Should(ContainSubstring("key"))
+		Expect(req.Secret).Should(Equal("secret"))
+	})
+})
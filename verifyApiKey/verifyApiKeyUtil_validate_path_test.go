@@ -15,12 +15,19 @@
 package verifyApiKey
 
 import (
+	"github.com/apid/apidApiMetadata/common"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Validate Path", func() {
 
+	matcher := common.CreateResourceMatcher(false)
+	validatePath := func(resources []string, path string) bool {
+		_, matched := matcher.Match("v1", "p1", resources, path)
+		return matched
+	}
+
 	It("validation1", func() {
 		s := validatePath([]string{}, "/foo")
 		Expect(s).Should(BeTrue())